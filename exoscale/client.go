@@ -1,6 +1,14 @@
 package exoscale
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/exoscale/egoscale"
@@ -14,50 +22,203 @@ const defaultDNSEndpoint = "https://api.exoscale.ch/dns"
 const defaultTimeout = 5 * time.Minute
 const defaultGzipUserData = true
 
-// BaseConfig represents the provider structure
+// BaseConfig represents the provider structure, shared as a pointer by all the resources
 type BaseConfig struct {
-	key             string
-	secret          string
-	timeout         time.Duration
-	computeEndpoint string
-	dnsEndpoint     string
-	s3Endpoint      string
-	gzipUserData    bool
-	computeClient   *egoscale.Client
-	dnsClient       *egoscale.Client
+	credentials  *credentials
+	compute      endpointConfig
+	dns          endpointConfig
+	s3Endpoint   string
+	gzipUserData bool
+	recordCache  *recordCache
+	zone         string
+	zoneCache    *zoneCache
+	retry        retryConfig
+
+	// clients are built once, sharing the same transport and its keep-alive pool
+	sync.Mutex
+	transport     http.RoundTripper
+	computeClient *egoscale.Client
+	dnsClient     *egoscale.Client
 }
 
-func getClient(endpoint string, meta interface{}) *egoscale.Client {
-	config := meta.(BaseConfig)
-	cs := egoscale.NewClient(endpoint, config.key, config.secret)
+// endpointConfig holds the settings of an API endpoint
+type endpointConfig struct {
+	endpoint string
+	timeout  time.Duration
+}
 
-	cs.Timeout = config.timeout
-	cs.HTTPClient.Timeout = config.timeout
+// newTransport builds the HTTP transport shared by the clients
+func newTransport(creds *credentials, retry retryConfig) http.RoundTripper {
+	var transport http.RoundTripper = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
 
 	if logging.IsDebugOrHigher() {
-		cs.HTTPClient.Transport = logging.NewTransport(
-			"exoscale",
-			cs.HTTPClient.Transport,
-		)
+		transport = logging.NewTransport("exoscale", transport)
+	}
+
+	if retry.maxRetries > 0 {
+		transport = &retryTransport{
+			transport: transport,
+			config:    retry,
+		}
+	}
+
+	if creds.Reloadable() {
+		transport = &credentialsTransport{
+			transport:   transport,
+			credentials: creds,
+		}
+	}
+
+	return &dnsStatusTransport{transport: transport}
+}
+
+// dnsStatusKey holds the HTTP status code among the errors of a DNS error response
+const dnsStatusKey = "http_status"
+
+// dnsStatusTransport adds the HTTP status code to the DNS error responses
+//
+// egoscale only decodes the message of the DNS errors, which isn't reliable
+// enough to tell a missing domain from a bad token.
+type dnsStatusTransport struct {
+	transport http.RoundTripper
+}
+
+// RoundTrip executes a single HTTP transaction
+func (t *dnsStatusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil || resp.StatusCode < 400 || req.Header.Get("X-DNS-TOKEN") == "" {
+		return resp, err
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close() // nolint: errcheck
+	if err != nil {
+		return nil, err
+	}
+
+	// The errors which aren't JSON, e.g. from a proxy, get the status as message
+	e := map[string]interface{}{"message": resp.Status}
+	if err := json.Unmarshal(b, &e); err != nil {
+		e = map[string]interface{}{"message": resp.Status}
+	}
+
+	errs, ok := e["errors"].(map[string]interface{})
+	if !ok {
+		errs = make(map[string]interface{})
+	}
+	errs[dnsStatusKey] = []string{strconv.Itoa(resp.StatusCode)}
+	e["errors"] = errs
+
+	if b, err = json.Marshal(e); err != nil {
+		return nil, err
+	}
+
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = int64(len(b))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	return resp, nil
+}
+
+// dnsRequest calls an endpoint of the DNS API that egoscale doesn't cover
+//
+// It goes through the client of the DNS API, hence its transport reloading
+// the credentials, retrying and adding the status code of the errors.
+func dnsRequest(meta interface{}, method, uri string) error {
+	config := meta.(*BaseConfig)
+	client := GetDNSClient(meta)
+
+	req, err := http.NewRequest(method, client.Endpoint+uri, nil)
+	if err != nil {
+		return err
+	}
+
+	key, secret := config.credentials.Get()
+	req.Header.Add("X-DNS-TOKEN", fmt.Sprintf("%s:%s", key, secret))
+	req.Header.Add("User-Agent", fmt.Sprintf("exoscale/egoscale (%v)", egoscale.Version))
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode < 400 {
+		return nil
+	}
+
+	e := new(egoscale.DNSErrorResponse)
+	if err := json.NewDecoder(resp.Body).Decode(e); err != nil {
+		return fmt.Errorf("%s %s: %s", method, uri, resp.Status)
+	}
+
+	return e
+}
+
+// dnsErrorStatus returns the HTTP status code of the DNS error, zero when unknown
+func dnsErrorStatus(e *egoscale.DNSErrorResponse) int {
+	if values := e.Errors[dnsStatusKey]; len(values) == 1 {
+		if status, err := strconv.Atoi(values[0]); err == nil {
+			return status
+		}
+	}
+
+	return 0
+}
+
+// getClient builds a client for the endpoint, the lock must be held
+func (config *BaseConfig) getClient(settings endpointConfig) *egoscale.Client {
+	if config.transport == nil {
+		config.transport = newTransport(config.credentials, config.retry)
+	}
+
+	key, secret := config.credentials.Get()
+	cs := egoscale.NewClient(settings.endpoint, key, secret)
+
+	cs.Timeout = settings.timeout
+	cs.HTTPClient = &http.Client{
+		Transport: config.transport,
+		Timeout:   settings.timeout,
 	}
 
 	return cs
 }
 
-// GetComputeClient builds a CloudStack client
+// GetComputeClient returns the CloudStack client
 func GetComputeClient(meta interface{}) *egoscale.Client {
-	config := meta.(BaseConfig)
+	config := meta.(*BaseConfig)
+
+	config.Lock()
+	defer config.Unlock()
+
 	if config.computeClient == nil {
-		config.computeClient = getClient(config.computeEndpoint, meta)
+		config.computeClient = config.getClient(config.compute)
 	}
 	return config.computeClient
 }
 
-// GetDNSClient builds a DNS client
+// GetDNSClient returns the DNS client
 func GetDNSClient(meta interface{}) *egoscale.Client {
-	config := meta.(BaseConfig)
+	config := meta.(*BaseConfig)
+
+	config.Lock()
+	defer config.Unlock()
+
 	if config.dnsClient == nil {
-		config.dnsClient = getClient(config.dnsEndpoint, meta)
+		config.dnsClient = config.getClient(config.dns)
 	}
 	return config.dnsClient
 }
@@ -0,0 +1,109 @@
+package exoscale
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/exoscale/egoscale"
+)
+
+func TestGetClient(t *testing.T) {
+	meta := &BaseConfig{
+		credentials: &credentials{key: "EXO", secret: "secret"},
+		compute:     endpointConfig{endpoint: defaultComputeEndpoint, timeout: time.Minute},
+		dns:         endpointConfig{endpoint: defaultDNSEndpoint, timeout: 2 * time.Minute},
+	}
+
+	compute := GetComputeClient(meta)
+	if compute != GetComputeClient(meta) {
+		t.Error("the compute client was expected to be built once")
+	}
+
+	dns := GetDNSClient(meta)
+	if dns != GetDNSClient(meta) {
+		t.Error("the DNS client was expected to be built once")
+	}
+
+	if compute.HTTPClient.Transport != dns.HTTPClient.Transport {
+		t.Error("the clients were expected to share the transport")
+	}
+
+	if compute.Endpoint != defaultComputeEndpoint || compute.Timeout != time.Minute {
+		t.Errorf("bad compute settings, got %s %s", compute.Endpoint, compute.Timeout)
+	}
+
+	if dns.Endpoint != defaultDNSEndpoint || dns.HTTPClient.Timeout != 2*time.Minute {
+		t.Errorf("bad DNS settings, got %s %s", dns.Endpoint, dns.HTTPClient.Timeout)
+	}
+}
+
+func TestDNSStatusTransport(t *testing.T) {
+	tests := []struct {
+		status      int
+		contentType string
+		body        string
+		message     string
+	}{
+		{http.StatusNotFound, "application/json", `{"message": "Domain not found"}`, "Domain not found"},
+		{http.StatusUnprocessableEntity, "application/json", `{"message": "Validation failed", "errors": {"name": ["is invalid"]}}`, "Validation failed"},
+		{http.StatusBadGateway, "text/html", "<html>Bad Gateway</html>", "502 Bad Gateway"},
+	}
+
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.body) // nolint: errcheck
+		}))
+
+		client := egoscale.NewClient(ts.URL, "EXO", "secret")
+		client.HTTPClient = &http.Client{Transport: &dnsStatusTransport{transport: http.DefaultTransport}}
+
+		_, err := client.GetDomain("example.com")
+		ts.Close()
+
+		e, ok := err.(*egoscale.DNSErrorResponse)
+		if !ok {
+			t.Errorf("%d: expected a DNS error, got %v", test.status, err)
+			continue
+		}
+		if status := dnsErrorStatus(e); status != test.status {
+			t.Errorf("%d: expected the status, got %d", test.status, status)
+		}
+		if e.Message != test.message {
+			t.Errorf("%d: expected the message %q, got %q", test.status, test.message, e.Message)
+		}
+	}
+}
+
+func TestDNSRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-DNS-TOKEN") != "EXO:secret" {
+			t.Errorf("expected the credentials, got %q", r.Header.Get("X-DNS-TOKEN"))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "DELETE" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Domain not found"}`) // nolint: errcheck
+		}
+	}))
+	defer ts.Close()
+
+	meta := &BaseConfig{
+		credentials: &credentials{key: "EXO", secret: "secret"},
+		dns:         endpointConfig{endpoint: ts.URL, timeout: time.Minute},
+	}
+
+	if err := dnsRequest(meta, "POST", "/v1/domains/example.com/auto_renewal"); err != nil {
+		t.Errorf("no errors were expected, got %s", err)
+	}
+
+	err := dnsRequest(meta, "DELETE", "/v1/domains/example.com/auto_renewal")
+	if !isNotFoundError(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package exoscale
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// exoAccount is an account of the exo CLI configuration
+type exoAccount struct {
+	Name        string
+	Account     string
+	Key         string
+	Secret      string
+	Endpoint    string
+	DNSEndpoint string
+	SOSEndpoint string
+	DefaultZone string
+}
+
+// exoConfig is the configuration of the exo CLI, e.g. ~/.config/exoscale/exoscale.toml
+type exoConfig struct {
+	DefaultAccount string
+	Accounts       []exoAccount
+}
+
+// exoConfigPaths returns the locations of the exo CLI configuration file
+func exoConfigPaths(usr *user.User) []string {
+	paths := make([]string, 0, 2)
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		paths = append(paths, filepath.Join(xdg, "exoscale", "exoscale.toml"))
+	}
+
+	if usr != nil {
+		paths = append(paths, filepath.Join(usr.HomeDir, ".config", "exoscale", "exoscale.toml"))
+	}
+
+	return paths
+}
+
+// loadExoConfig reads the exo CLI configuration file
+func loadExoConfig(path string) (*exoConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint: errcheck
+
+	config, err := parseExoConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return config, nil
+}
+
+// parseExoConfig reads the subset of TOML written by the exo CLI
+//
+// Only the top-level keys and the [[accounts]] tables are kept, the values
+// being strings, booleans or numbers on a single line.
+func parseExoConfig(r io.Reader) (*exoConfig, error) {
+	config := &exoConfig{}
+
+	table := ""
+	var account *exoAccount
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			name := strings.TrimSpace(stripTOMLComment(text))
+			switch {
+			case strings.HasPrefix(name, "[[") && strings.HasSuffix(name, "]]"):
+				table = strings.TrimSpace(name[2 : len(name)-2])
+				account = nil
+				if table == "accounts" {
+					config.Accounts = append(config.Accounts, exoAccount{})
+					account = &config.Accounts[len(config.Accounts)-1]
+				}
+			case !strings.HasPrefix(name, "[[") && strings.HasSuffix(name, "]"):
+				table = strings.TrimSpace(name[1 : len(name)-1])
+				account = nil
+			default:
+				return nil, fmt.Errorf("line %d: invalid table %q", line, text)
+			}
+			continue
+		}
+
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", line, text)
+		}
+
+		key := strings.ToLower(strings.Trim(strings.TrimSpace(parts[0]), `"`))
+		value, err := parseTOMLValue(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		switch {
+		case table == "" && key == "defaultaccount":
+			config.DefaultAccount = value
+		case account != nil:
+			account.set(key, value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// The accounts of the older versions were named by the account field
+	for i := range config.Accounts {
+		if config.Accounts[i].Name == "" {
+			config.Accounts[i].Name = config.Accounts[i].Account
+		}
+	}
+
+	return config, nil
+}
+
+func (a *exoAccount) set(key, value string) {
+	switch key {
+	case "name":
+		a.Name = value
+	case "account":
+		a.Account = value
+	case "key":
+		a.Key = value
+	case "secret":
+		a.Secret = value
+	case "endpoint", "computeendpoint":
+		a.Endpoint = value
+	case "dnsendpoint":
+		a.DNSEndpoint = value
+	case "sosendpoint":
+		a.SOSEndpoint = value
+	case "defaultzone":
+		a.DefaultZone = value
+	}
+}
+
+// FindAccount returns the account by name, or the default one when the name is empty
+func (c *exoConfig) FindAccount(name string) (*exoAccount, error) {
+	if name == "" {
+		name = c.DefaultAccount
+	}
+
+	if name == "" && len(c.Accounts) == 1 {
+		return &c.Accounts[0], nil
+	}
+
+	names := make([]string, len(c.Accounts))
+	for i := range c.Accounts {
+		if c.Accounts[i].Name == name {
+			return &c.Accounts[i], nil
+		}
+		names[i] = c.Accounts[i].Name
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("no default account is set, existing accounts: %s", strings.Join(names, ", "))
+	}
+
+	return nil, fmt.Errorf("account %q not found, existing accounts: %s", name, strings.Join(names, ", "))
+}
+
+// stripTOMLComment removes the trailing comment, outside of any string
+func stripTOMLComment(value string) string {
+	quote := rune(0)
+	escaped := false
+	for i, c := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return value[:i]
+		}
+	}
+
+	return value
+}
+
+// parseTOMLValue returns a string, boolean or number as a string
+func parseTOMLValue(value string) (string, error) {
+	value = strings.TrimSpace(stripTOMLComment(value))
+
+	switch {
+	case strings.HasPrefix(value, `"""`), strings.HasPrefix(value, "'''"):
+		return "", fmt.Errorf("multi-line strings are not supported")
+	case strings.HasPrefix(value, `"`):
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return s, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return value[1 : len(value)-1], nil
+	case value == "":
+		return "", fmt.Errorf("missing value")
+	}
+
+	// booleans, numbers, dates and arrays are kept as is
+	return value, nil
+}
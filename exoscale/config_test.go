@@ -0,0 +1,99 @@
+package exoscale
+
+import (
+	"strings"
+	"testing"
+)
+
+var testExoConfig = `
+# exo CLI configuration
+defaultaccount = "prod"
+
+[[accounts]]
+  account = "company"
+  defaultZone = "ch-gva-2"
+  endpoint = "https://api.exoscale.ch/compute"
+  key = "EXOprod"
+  name = "prod"
+  secret = "s3cr#t" # a comment
+  sosEndpoint = "https://sos-ch-dk-2.exo.io"
+
+[[accounts]]
+  account = "staging"
+  dnsEndpoint = 'https://api.example.net/dns'
+  key = "EXOstaging"
+  secret = "secret"
+`
+
+func TestParseExoConfig(t *testing.T) {
+	config, err := parseExoConfig(strings.NewReader(testExoConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.DefaultAccount != "prod" {
+		t.Errorf("bad default account, got %q", config.DefaultAccount)
+	}
+
+	if len(config.Accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(config.Accounts))
+	}
+
+	prod := config.Accounts[0]
+	if prod.Key != "EXOprod" || prod.Secret != "s3cr#t" || prod.DefaultZone != "ch-gva-2" || prod.SOSEndpoint != "https://sos-ch-dk-2.exo.io" {
+		t.Errorf("bad account, got %#v", prod)
+	}
+
+	staging := config.Accounts[1]
+	if staging.Name != "staging" || staging.DNSEndpoint != "https://api.example.net/dns" {
+		t.Errorf("bad account, got %#v", staging)
+	}
+}
+
+func TestParseExoConfigFailure(t *testing.T) {
+	contents := []string{
+		"defaultaccount",
+		"defaultaccount = ",
+		`defaultaccount = "prod`,
+		"[[accounts]\nkey = 'EXO'",
+		"key = \"\"\"\nEXO\"\"\"",
+	}
+
+	for _, content := range contents {
+		if _, err := parseExoConfig(strings.NewReader(content)); err == nil {
+			t.Errorf("%q: an error was expected", content)
+		}
+	}
+}
+
+func TestExoConfigFindAccount(t *testing.T) {
+	config, err := parseExoConfig(strings.NewReader(testExoConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := config.FindAccount("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Name != "prod" {
+		t.Errorf("expected the default account, got %q", account.Name)
+	}
+
+	account, err = config.FindAccount("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Key != "EXOstaging" {
+		t.Errorf("bad account, got %#v", account)
+	}
+
+	if _, err := config.FindAccount("dev"); err == nil {
+		t.Error("an error was expected")
+	}
+
+	config.DefaultAccount = ""
+	if _, err := config.FindAccount(""); err == nil {
+		t.Error("an error was expected without a default account")
+	}
+}
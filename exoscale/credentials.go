@@ -0,0 +1,266 @@
+package exoscale
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/exoscale/egoscale"
+)
+
+// credentials holds the API key and secret
+//
+// When they come from a command or a file, they are read again after an
+// authentication error, e.g. when the key was rotated during a long apply.
+type credentials struct {
+	sync.RWMutex
+	key     string
+	secret  string
+	command string
+	file    string
+}
+
+// newCredentials reads the credentials from the command, or the file
+func newCredentials(command, file string) (*credentials, error) {
+	c := &credentials{
+		command: command,
+		file:    file,
+	}
+
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Get returns the current key and secret
+func (c *credentials) Get() (string, string) {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.key, c.secret
+}
+
+// Reloadable tells whether the credentials come from a command or a file
+func (c *credentials) Reloadable() bool {
+	return c.command != "" || c.file != ""
+}
+
+// Reload reads the credentials again and tells whether they have changed
+func (c *credentials) Reload() (bool, error) {
+	if !c.Reloadable() {
+		return false, nil
+	}
+
+	var b []byte
+	var err error
+	source := c.file
+	if c.command != "" {
+		source = c.command
+		b, err = runCredentialsCommand(c.command)
+	} else {
+		b, err = ioutil.ReadFile(c.file)
+	}
+	if err != nil {
+		return false, fmt.Errorf("credentials not loaded from %q: %s", source, err)
+	}
+
+	key, secret, err := parseCredentials(b)
+	if err != nil {
+		return false, fmt.Errorf("credentials not loaded from %q: %s", source, err)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	changed := key != c.key || secret != c.secret
+	c.key = key
+	c.secret = secret
+
+	return changed, nil
+}
+
+// runCredentialsCommand runs the command through the shell and returns its output
+func runCredentialsCommand(command string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+// parseCredentials reads the {"key": "...", "secret": "..."} JSON document
+func parseCredentials(b []byte) (string, string, error) {
+	var value struct {
+		Key    string `json:"key"`
+		Secret string `json:"secret"`
+	}
+
+	if err := json.Unmarshal(b, &value); err != nil {
+		return "", "", fmt.Errorf("expected a JSON document with a key and a secret: %s", err)
+	}
+
+	if value.Key == "" || value.Secret == "" {
+		return "", "", fmt.Errorf("expected a JSON document with a key and a secret")
+	}
+
+	return value.Key, value.Secret, nil
+}
+
+// credentialsTransport signs the requests with the current credentials
+//
+// On an authentication error, the credentials are reloaded and, if they have
+// changed, the request is signed again and retried once.
+type credentialsTransport struct {
+	transport   http.RoundTripper
+	credentials *credentials
+}
+
+// RoundTrip executes a single HTTP transaction
+func (t *credentialsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, secret := t.credentials.Get()
+	signed, err := signRequest(req, key, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.transport.RoundTrip(signed)
+	if err != nil || (resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden) {
+		return resp, err
+	}
+
+	changed, err := t.credentials.Reload()
+	if err != nil {
+		log.Printf("[WARN] %s", err)
+		return resp, nil
+	}
+
+	if !changed {
+		return resp, nil
+	}
+
+	log.Printf("[INFO] credentials reloaded after an authentication error, retrying")
+	resp.Body.Close() // nolint: errcheck
+
+	key, secret = t.credentials.Get()
+	signed, err = signRequest(req, key, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.transport.RoundTrip(signed)
+}
+
+// signRequest returns a copy of the request, signed with the given credentials
+//
+// The DNS API gets the credentials in a header, the compute one gets them
+// as parameters with the signature of the query string.
+func signRequest(req *http.Request, key, secret string) (*http.Request, error) {
+	signed := new(http.Request)
+	*signed = *req
+	signed.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		signed.Header[k] = v
+	}
+
+	if signed.Header.Get("X-DNS-TOKEN") != "" {
+		signed.Header.Set("X-DNS-TOKEN", fmt.Sprintf("%s:%s", key, secret))
+		return signed, resetBody(signed)
+	}
+
+	if req.Method == "POST" && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+
+		params, err := url.ParseQuery(string(b))
+		if err != nil || params.Get("signature") == "" {
+			return signed, resetBody(signed)
+		}
+
+		query, err := signParams(params, key, secret)
+		if err != nil {
+			return nil, err
+		}
+
+		signed.Body = ioutil.NopCloser(strings.NewReader(query))
+		signed.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(query)), nil
+		}
+		signed.ContentLength = int64(len(query))
+		signed.Header.Set("Content-Length", strconv.Itoa(len(query)))
+		return signed, nil
+	}
+
+	params := req.URL.Query()
+	if params.Get("signature") == "" {
+		return signed, resetBody(signed)
+	}
+
+	query, err := signParams(params, key, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	u := *req.URL
+	u.RawQuery = query
+	signed.URL = &u
+
+	return signed, resetBody(signed)
+}
+
+// signParams replaces the API key and the signature of the compute parameters
+func signParams(params url.Values, key, secret string) (string, error) {
+	params.Del("signature")
+	params.Set("apikey", key)
+
+	signature, err := egoscale.NewClient("", key, secret).Sign(params)
+	if err != nil {
+		return "", err
+	}
+	params.Set("signature", signature)
+
+	return params.Encode(), nil
+}
+
+// resetBody rewinds the body of the request, so that it can be sent again
+func resetBody(req *http.Request) error {
+	if req.GetBody == nil || req.Body == nil {
+		return nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+
+	return nil
+}
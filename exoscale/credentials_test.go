@@ -0,0 +1,155 @@
+package exoscale
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/exoscale/egoscale"
+)
+
+func TestParseCredentials(t *testing.T) {
+	key, secret, err := parseCredentials([]byte(`{"key": "EXO1", "secret": "s1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "EXO1" || secret != "s1" {
+		t.Errorf("bad credentials, got %q %q", key, secret)
+	}
+
+	for _, value := range []string{"", "EXO1", `{"key": "EXO1"}`, `{"secret": "s1"}`} {
+		if _, _, err := parseCredentials([]byte(value)); err == nil {
+			t.Errorf("%q: an error was expected", value)
+		}
+	}
+}
+
+func TestCredentialsReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	file := filepath.Join(dir, "credentials.json")
+	if err := ioutil.WriteFile(file, []byte(`{"key": "EXO1", "secret": "s1"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := newCredentials("", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := creds.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("the credentials haven't changed")
+	}
+
+	if err := ioutil.WriteFile(file, []byte(`{"key": "EXO2", "secret": "s2"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err = creds.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("the credentials have changed")
+	}
+	if key, _ := creds.Get(); key != "EXO2" {
+		t.Errorf("bad key, got %q", key)
+	}
+
+	creds, err = newCredentials(`echo '{"key": "EXO3", "secret": "s3"}'`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, secret := creds.Get(); key != "EXO3" || secret != "s3" {
+		t.Errorf("bad credentials, got %q %q", key, secret)
+	}
+
+	if _, err := newCredentials("exit 1", ""); err == nil {
+		t.Error("an error was expected")
+	}
+}
+
+func TestCredentialsTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	file := filepath.Join(dir, "credentials.json")
+	if err := ioutil.WriteFile(file, []byte(`{"key": "EXO1", "secret": "s1"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := newCredentials("", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the second key is valid
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		params := r.URL.Query()
+		signature := params.Get("signature")
+		params.Del("signature")
+		expected, _ := egoscale.NewClient("", "EXO2", "s2").Sign(params)
+
+		if params.Get("apikey") != "EXO2" || signature != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := egoscale.NewClient(ts.URL, "EXO1", "s1")
+	params, err := client.Payload(&egoscale.ListZones{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := client.Sign(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.Set("signature", signature)
+
+	req, err := http.NewRequest("GET", ts.URL+"?"+params.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(`{"key": "EXO2", "secret": "s2"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := &credentialsTransport{
+		transport:   http.DefaultTransport,
+		credentials: creds,
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("the request was expected to be signed again, got %d", resp.StatusCode)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
@@ -0,0 +1,36 @@
+package exoscale
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func domainZoneFileDataSource() *schema.Resource {
+	return &schema.Resource{
+		Read: readZoneFileDataSource,
+
+		Schema: map[string]*schema.Schema{
+			"domain": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"content": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "RFC 1035 master file of all the records, NS and SOA included",
+			},
+		},
+	}
+}
+
+func readZoneFileDataSource(d *schema.ResourceData, meta interface{}) error {
+	client := GetDNSClient(meta)
+
+	domain := d.Get("domain").(string)
+	records, err := client.GetRecords(domain)
+	if err != nil {
+		return err
+	}
+
+	d.SetId(domain)
+	return d.Set("content", renderZoneFile(domain, records))
+}
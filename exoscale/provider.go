@@ -3,15 +3,18 @@ package exoscale
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/exoscale/egoscale"
 	"github.com/go-ini/ini"
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
 	"github.com/hashicorp/terraform/terraform"
 )
 
@@ -48,10 +51,22 @@ func Provider() terraform.ResourceProvider {
 					"CLOUDSTACK_SECRET_KEY",
 				}, nil),
 			},
+			"credentials_command": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Command printing the credentials as JSON: {\"key\": \"EXO...\", \"secret\": \"...\"}",
+				DefaultFunc: schema.EnvDefaultFunc("EXOSCALE_CREDENTIALS_COMMAND", ""),
+			},
+			"credentials_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "File containing the credentials as JSON: {\"key\": \"EXO...\", \"secret\": \"...\"}",
+				DefaultFunc: schema.EnvDefaultFunc("EXOSCALE_CREDENTIALS_FILE", ""),
+			},
 			"config": {
 				Type:        schema.TypeString,
 				Optional:    true,
-				Description: fmt.Sprintf("CloudStack ini configuration filename (by default: %s)", defaultConfig),
+				Description: fmt.Sprintf("CloudStack ini, or exo CLI toml, configuration filename (by default: %s)", defaultConfig),
 				DefaultFunc: schema.MultiEnvDefaultFunc([]string{
 					"EXOSCALE_CONFIG",
 					"CLOUDSTACK_CONFIG",
@@ -73,6 +88,18 @@ func Provider() terraform.ResourceProvider {
 					"CLOUDSTACK_REGION",
 				}, defaultProfile),
 			},
+			"account": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "exo CLI account name, from ~/.config/exoscale/exoscale.toml (by default: its default account)",
+				DefaultFunc: schema.EnvDefaultFunc("EXOSCALE_ACCOUNT", ""),
+			},
+			"zone": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Default zone of the resources, e.g. ch-gva-2 (by default: the default zone of the exo CLI account, if any)",
+				DefaultFunc: schema.EnvDefaultFunc("EXOSCALE_ZONE", ""),
+			},
 			"compute_endpoint": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -105,6 +132,43 @@ func Provider() terraform.ResourceProvider {
 					defaultGzipUserData),
 				DefaultFunc: schema.EnvDefaultFunc("EXOSCALE_GZIP_USER_DATA", defaultGzipUserData),
 			},
+			"max_retries": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				Description: fmt.Sprintf(
+					"Number of times a failing API call is sent again (by default: %d)",
+					defaultMaxRetries),
+				DefaultFunc:  schema.EnvDefaultFunc("EXOSCALE_MAX_RETRIES", defaultMaxRetries),
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"retry_backoff": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Description: fmt.Sprintf(
+					"Delay between the retries, monotonic or fibonacci (by default: %s)",
+					defaultRetryBackoff),
+				DefaultFunc: schema.EnvDefaultFunc("EXOSCALE_RETRY_BACKOFF", defaultRetryBackoff),
+				ValidateFunc: validation.StringInSlice([]string{
+					"monotonic",
+					"fibonacci",
+				}, false),
+			},
+			"retryable_http_statuses": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Description: "HTTP statuses worth a retry (by default: 429, 502, 503 and 504)",
+				Elem: &schema.Schema{
+					Type: schema.TypeInt,
+				},
+			},
+			"retryable_cloudstack_codes": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Description: "CloudStack error and exception codes worth a retry (by default: 530, 4285 and 4300)",
+				Elem: &schema.Schema{
+					Type: schema.TypeInt,
+				},
+			},
 			"delay": {
 				Type:       schema.TypeInt,
 				Optional:   true,
@@ -118,6 +182,8 @@ func Provider() terraform.ResourceProvider {
 			"exoscale_affinity":            affinityGroupResource(),
 			"exoscale_domain":              domainResource(),
 			"exoscale_domain_record":       domainRecordResource(),
+			"exoscale_domain_record_set":   domainRecordSetResource(),
+			"exoscale_domain_zonefile":     domainZoneFileResource(),
 			"exoscale_security_group":      securityGroupResource(),
 			"exoscale_security_group_rule": securityGroupRuleResource(),
 			"exoscale_ipaddress":           elasticIPResource(),
@@ -126,6 +192,10 @@ func Provider() terraform.ResourceProvider {
 			"exoscale_nic":                 nicResource(),
 		},
 
+		DataSourcesMap: map[string]*schema.Resource{
+			"exoscale_domain_zonefile": domainZoneFileDataSource(),
+		},
+
 		ConfigureFunc: providerConfigure,
 	}
 }
@@ -135,6 +205,8 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	secret, secretOK := d.GetOk("secret")
 	endpoint := d.Get("compute_endpoint").(string)
 	dnsEndpoint := d.Get("dns_endpoint").(string)
+	s3Endpoint := ""
+	zone := d.Get("zone").(string)
 
 	// deprecation support
 	token, tokenOK := d.GetOk("token")
@@ -143,13 +215,33 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 		key = token
 	}
 
-	if keyOK || secretOK {
+	var creds *credentials
+	command := d.Get("credentials_command").(string)
+	file := d.Get("credentials_file").(string)
+
+	if command != "" || file != "" {
+		if command != "" && file != "" {
+			return nil, fmt.Errorf("credentials_command and credentials_file cannot be both set")
+		}
+
+		// Support `~/`
+		if usr, err := user.Current(); err == nil && strings.HasPrefix(file, "~/") {
+			file = filepath.Join(usr.HomeDir, file[2:])
+		}
+
+		c, err := newCredentials(command, file)
+		if err != nil {
+			return nil, err
+		}
+		creds = c
+	} else if keyOK || secretOK {
 		if !keyOK || !secretOK {
 			return nil, fmt.Errorf("key (%#v) and secret (%#v) must be set", key.(string), secret.(string))
 		}
 	} else {
 		config := d.Get("config").(string)
 		region := d.Get("region")
+		account := d.Get("account").(string)
 
 		// deprecation support
 		profile, profileOK := d.GetOk("profile")
@@ -167,20 +259,24 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 
 		// Convert relative path to absolute
 		config, _ = filepath.Abs(config)
-		localConfig, _ := filepath.Abs("cloudstack.ini")
 
-		inis := []string{
-			config,
-			localConfig,
-		}
+		// The exo CLI configuration is used when asked for, or as a fallback
+		inis := make([]string, 0)
+		tomls := exoConfigPaths(usr)
+		if strings.HasSuffix(config, ".toml") {
+			tomls = []string{config}
+		} else if account == "" {
+			localConfig, _ := filepath.Abs("cloudstack.ini")
 
-		if usr != nil {
-			inis = append(inis, filepath.Join(usr.HomeDir, ".cloudstack.ini"))
+			inis = append(inis, config, localConfig)
+			if usr != nil {
+				inis = append(inis, filepath.Join(usr.HomeDir, ".cloudstack.ini"))
+			}
 		}
 
 		// Stops at the first file that exists
 		config = ""
-		for _, i := range inis {
+		for _, i := range append(inis, tomls...) {
 			if _, err := os.Stat(i); err != nil {
 				continue
 			}
@@ -189,51 +285,152 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 		}
 
 		if config == "" {
-			return nil, fmt.Errorf("key (%s), secret are missing, or config file not found within: %s", key, strings.Join(inis, ", "))
+			return nil, fmt.Errorf("key (%s), secret are missing, or config file not found within: %s", key, strings.Join(append(inis, tomls...), ", "))
 		}
 
-		cfg, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, config)
-		if err != nil {
-			return nil, fmt.Errorf("Config file not loaded: %s", err)
-		}
+		if strings.HasSuffix(config, ".toml") {
+			cfg, err := loadExoConfig(config)
+			if err != nil {
+				return nil, fmt.Errorf("Config file not loaded: %s", err)
+			}
 
-		section, err := cfg.GetSection(region.(string))
-		if err != nil {
-			sections := strings.Join(cfg.SectionStrings(), ", ")
-			return nil, fmt.Errorf("%s. Existing sections: %s", err, sections)
+			a, err := cfg.FindAccount(account)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", config, err)
+			}
+
+			if a.Key == "" || a.Secret == "" {
+				return nil, fmt.Errorf("%s: key and secret of account %q must be set", config, a.Name)
+			}
+
+			key = a.Key
+			secret = a.Secret
+			if a.Endpoint != "" {
+				endpoint = a.Endpoint
+				dnsEndpoint = strings.Replace(endpoint, "/compute", "/dns", 1)
+			}
+			if a.DNSEndpoint != "" {
+				dnsEndpoint = a.DNSEndpoint
+			}
+			s3Endpoint = a.SOSEndpoint
+			if zone == "" {
+				zone = a.DefaultZone
+			}
+		} else {
+			cfg, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, config)
+			if err != nil {
+				return nil, fmt.Errorf("Config file not loaded: %s", err)
+			}
+
+			section, err := cfg.GetSection(region.(string))
+			if err != nil {
+				sections := strings.Join(cfg.SectionStrings(), ", ")
+				return nil, fmt.Errorf("%s. Existing sections: %s", err, sections)
+			}
+
+			t, err := section.GetKey("key")
+			if err != nil {
+				return nil, err
+			}
+			key = t.String()
+
+			s, err := section.GetKey("secret")
+			if err != nil {
+				return nil, err
+			}
+			secret = s.String()
+
+			e, err := section.GetKey("endpoint")
+			if err == nil {
+				endpoint = e.String()
+				dnsEndpoint = strings.Replace(endpoint, "/compute", "/dns", 1)
+			}
 		}
+	}
 
-		t, err := section.GetKey("key")
-		if err != nil {
-			return nil, err
+	if creds == nil {
+		creds = &credentials{
+			key:    key.(string),
+			secret: secret.(string),
 		}
-		key = t.String()
+	}
 
-		s, err := section.GetKey("secret")
-		if err != nil {
-			return nil, err
+	timeout := time.Duration(int64(d.Get("timeout").(float64)) * int64(time.Second))
+
+	httpStatuses := defaultRetryableHTTPStatuses
+	if set := d.Get("retryable_http_statuses").(*schema.Set); set.Len() > 0 {
+		httpStatuses = make([]int, 0, set.Len())
+		for _, status := range set.List() {
+			httpStatuses = append(httpStatuses, status.(int))
 		}
-		secret = s.String()
+	}
 
-		e, err := section.GetKey("endpoint")
-		if err == nil {
-			endpoint = e.String()
-			dnsEndpoint = strings.Replace(endpoint, "/compute", "/dns", 1)
+	cloudStackCodes := defaultRetryableCloudStackCodes
+	if set := d.Get("retryable_cloudstack_codes").(*schema.Set); set.Len() > 0 {
+		cloudStackCodes = make([]int, 0, set.Len())
+		for _, code := range set.List() {
+			cloudStackCodes = append(cloudStackCodes, code.(int))
 		}
 	}
 
-	baseConfig := BaseConfig{
-		key:             key.(string),
-		secret:          secret.(string),
-		timeout:         time.Duration(int64(d.Get("timeout").(float64)) * int64(time.Second)),
-		computeEndpoint: endpoint,
-		dnsEndpoint:     dnsEndpoint,
-		gzipUserData:    d.Get("gzip_user_data").(bool),
+	baseConfig := &BaseConfig{
+		credentials: creds,
+		compute: endpointConfig{
+			endpoint: endpoint,
+			timeout:  timeout,
+		},
+		dns: endpointConfig{
+			endpoint: dnsEndpoint,
+			timeout:  timeout,
+		},
+		s3Endpoint:   s3Endpoint,
+		gzipUserData: d.Get("gzip_user_data").(bool),
+		recordCache:  newRecordCache(),
+		zone:         zone,
+		zoneCache:    &zoneCache{zones: make(map[string]*egoscale.Zone)},
+		retry:        newRetryConfig(d.Get("max_retries").(int), d.Get("retry_backoff").(string), httpStatuses, cloudStackCodes),
 	}
 
 	return baseConfig, nil
 }
 
+// zoneCache keeps the zones resolved by name, once per provider
+type zoneCache struct {
+	sync.Mutex
+	zones map[string]*egoscale.Zone
+}
+
+// getZone resolves the zone of the resource, falling back to the one of the provider
+func getZone(ctx context.Context, d *schema.ResourceData, meta interface{}) (*egoscale.Zone, error) {
+	config := meta.(*BaseConfig)
+
+	zoneName := d.Get("zone").(string)
+	if zoneName == "" {
+		zoneName = config.zone
+	}
+
+	if zoneName == "" {
+		return nil, fmt.Errorf("zone must be set, either on the resource or on the provider")
+	}
+
+	cache := config.zoneCache
+	cache.Lock()
+	defer cache.Unlock()
+
+	key := strings.ToLower(zoneName)
+	if zone, ok := cache.zones[key]; ok {
+		return zone, nil
+	}
+
+	zone, err := getZoneByName(ctx, GetComputeClient(meta), zoneName)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.zones[key] = zone
+	return zone, nil
+}
+
 func getZoneByName(ctx context.Context, client *egoscale.Client, zoneName string) (*egoscale.Zone, error) {
 	resp, err := client.RequestWithContext(ctx, &egoscale.ListZones{
 		Name: strings.ToLower(zoneName),
@@ -268,15 +465,50 @@ func getNetworkOfferingByName(ctx context.Context, client *egoscale.Client, zone
 	return &(networks.NetworkOffering[0]), nil
 }
 
-// handleNotFound inspects the CloudStack ErrorCode to guess if the resource is missing
+// apiErrorKind classifies the errors of both the compute and the DNS APIs
+type apiErrorKind int
+
+const (
+	apiErrorOther apiErrorKind = iota
+	apiErrorNotFound
+	apiErrorUnauthorized
+)
+
+// classifyError tells what kind of error was returned by either API
+//
+// The DNS errors get their HTTP status code from the dnsStatusTransport.
+func classifyError(err error) apiErrorKind {
+	switch e := err.(type) {
+	case *egoscale.ErrorResponse:
+		switch e.ErrorCode {
+		case egoscale.ParamError:
+			return apiErrorNotFound
+		case egoscale.Unauthorized:
+			return apiErrorUnauthorized
+		}
+	case *egoscale.DNSErrorResponse:
+		switch dnsErrorStatus(e) {
+		case http.StatusNotFound:
+			return apiErrorNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return apiErrorUnauthorized
+		}
+	}
+
+	return apiErrorOther
+}
+
+// isNotFoundError tells whether the resource is missing
+func isNotFoundError(err error) bool {
+	return classifyError(err) == apiErrorNotFound
+}
+
+// handleNotFound inspects the API error to guess if the resource is missing
 // and then removes it (unsetting the ID) and succeeds.
 func handleNotFound(d *schema.ResourceData, err error) error {
-	if r, ok := err.(*egoscale.ErrorResponse); ok {
-		if r.ErrorCode == egoscale.ParamError {
-			d.SetId("")
-			return nil
-		}
-		return r
+	if isNotFoundError(err) {
+		d.SetId("")
+		return nil
 	}
 	return err
 }
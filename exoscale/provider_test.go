@@ -1,9 +1,12 @@
 package exoscale
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"testing"
 
+	"github.com/exoscale/egoscale"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 )
@@ -28,6 +31,51 @@ func TestProvider_impl(t *testing.T) {
 	var _ terraform.ResourceProvider = Provider()
 }
 
+func TestClassifyError(t *testing.T) {
+	errs := []struct {
+		err      error
+		expected apiErrorKind
+	}{
+		{&egoscale.ErrorResponse{ErrorCode: egoscale.ParamError}, apiErrorNotFound},
+		{&egoscale.ErrorResponse{ErrorCode: egoscale.Unauthorized}, apiErrorUnauthorized},
+		{&egoscale.ErrorResponse{ErrorCode: egoscale.InternalError}, apiErrorOther},
+		{&egoscale.DNSErrorResponse{Message: "Domain `example.com` not found", Errors: map[string][]string{dnsStatusKey: {"404"}}}, apiErrorNotFound},
+		{&egoscale.DNSErrorResponse{Message: "Authentication failed", Errors: map[string][]string{dnsStatusKey: {"401"}}}, apiErrorUnauthorized},
+		{&egoscale.DNSErrorResponse{Message: "Validation failed", Errors: map[string][]string{dnsStatusKey: {"422"}}}, apiErrorOther},
+		{&egoscale.DNSErrorResponse{Message: "Domain `example.com` not found"}, apiErrorOther},
+		{fmt.Errorf("not found"), apiErrorOther},
+	}
+
+	for _, e := range errs {
+		if kind := classifyError(e.err); kind != e.expected {
+			t.Errorf("%s: expected %d, got %d", e.err, e.expected, kind)
+		}
+	}
+}
+
+func TestGetZone(t *testing.T) {
+	zone := &egoscale.Zone{Name: "ch-dk-2"}
+	meta := &BaseConfig{
+		zone:      "CH-DK-2",
+		zoneCache: &zoneCache{zones: map[string]*egoscale.Zone{"ch-dk-2": zone}},
+	}
+
+	// the cached zone of the provider doesn't hit the API
+	d := elasticIPResource().TestResourceData()
+	z, err := getZone(context.Background(), d, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z != zone {
+		t.Errorf("expected the zone of the provider, got %#v", z)
+	}
+
+	meta.zone = ""
+	if _, err := getZone(context.Background(), d, meta); err == nil {
+		t.Error("an error was expected without any zone")
+	}
+}
+
 func testAccPreCheck(t *testing.T) {
 	key := os.Getenv("EXOSCALE_API_KEY")
 	secret := os.Getenv("EXOSCALE_API_SECRET")
@@ -38,4 +86,5 @@ func testAccPreCheck(t *testing.T) {
 
 var EXOSCALE_ZONE = "ch-dk-2"
 var EXOSCALE_TEMPLATE = "Linux Ubuntu 18.04 LTS 64-bit"
+var EXOSCALE_REBUILD_TEMPLATE = "Linux Debian 9 64-bit"
 var EXOSCALE_NETWORK_OFFERING = "PrivNet"
@@ -0,0 +1,77 @@
+package exoscale
+
+import (
+	"sync"
+
+	"github.com/exoscale/egoscale"
+)
+
+// recordCache maps the DNS record IDs to their domain
+//
+// It's built once per provider, with one GetRecords per domain, and shared by
+// all the records which don't know their domain yet.
+type recordCache struct {
+	sync.Mutex
+	domains map[int64]string
+	loaded  bool
+}
+
+func newRecordCache() *recordCache {
+	return &recordCache{
+		domains: make(map[int64]string),
+	}
+}
+
+// getRecordCache returns the cache of the provider
+func getRecordCache(meta interface{}) *recordCache {
+	return meta.(*BaseConfig).recordCache
+}
+
+// Domain returns the domain of the record, empty if it doesn't exist
+func (c *recordCache) Domain(client *egoscale.Client, id int64) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if domain, ok := c.domains[id]; ok {
+		return domain, nil
+	}
+
+	if c.loaded {
+		return "", nil
+	}
+
+	domains, err := client.GetDomains()
+	if err != nil {
+		return "", err
+	}
+
+	for _, domain := range domains {
+		records, err := client.GetRecords(domain.Name)
+		if err != nil {
+			return "", err
+		}
+
+		for _, record := range records {
+			c.domains[record.ID] = domain.Name
+		}
+	}
+	c.loaded = true
+
+	return c.domains[id], nil
+}
+
+// Add remembers the domain of the record
+func (c *recordCache) Add(id int64, domain string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.domains[id] = domain
+}
+
+// Remove forgets the record
+func (c *recordCache) Remove(id int64) {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.domains, id)
+}
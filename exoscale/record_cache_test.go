@@ -0,0 +1,30 @@
+package exoscale
+
+import (
+	"testing"
+)
+
+func TestRecordCache(t *testing.T) {
+	cache := newRecordCache()
+	cache.Add(42, "example.com")
+
+	// a known record doesn't hit the API, hence the nil client
+	domain, err := cache.Domain(nil, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain != "example.com" {
+		t.Errorf("bad domain, expected example.com, got %q", domain)
+	}
+
+	cache.Remove(42)
+	cache.loaded = true
+
+	domain, err = cache.Domain(nil, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain != "" {
+		t.Errorf("the record was removed, got %q", domain)
+	}
+}
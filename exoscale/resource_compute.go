@@ -7,15 +7,19 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
+	"net"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/exoscale/egoscale"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/helper/validation"
 )
 
+const defaultComputeSize = "Medium"
+
 func computeResource() *schema.Resource {
 	s := map[string]*schema.Schema{
 		"name": {
@@ -27,15 +31,50 @@ func computeResource() *schema.Resource {
 			Optional: true,
 			Computed: true,
 		},
+		"hostname": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			Computed:     true,
+			ValidateFunc: ValidateHostnameString,
+			Description:  "Hostname of the instance, the display_name by default when it's a valid one",
+		},
 		"template": {
 			Type:     schema.TypeString,
 			Required: true,
-			ForceNew: true,
+		},
+		"rebuild_on_template_change": {
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Default:     false,
+			Description: "Reimage the root disk in place on a template change, instead of creating a new instance",
 		},
 		"size": {
-			Type:     schema.TypeString,
-			Optional: true,
-			Default:  "Medium",
+			Type:          schema.TypeString,
+			Optional:      true,
+			Computed:      true,
+			ConflictsWith: []string{"cpu", "memory", "cpu_speed"},
+			Description:   fmt.Sprintf("Name of the service offering (by default: %s)", defaultComputeSize),
+		},
+		"cpu": {
+			Type:          schema.TypeInt,
+			Optional:      true,
+			ConflictsWith: []string{"size"},
+			ValidateFunc:  validation.IntAtLeast(1),
+			Description:   "Number of CPUs of a customizable service offering",
+		},
+		"memory": {
+			Type:          schema.TypeInt,
+			Optional:      true,
+			ConflictsWith: []string{"size"},
+			ValidateFunc:  validation.IntAtLeast(1),
+			Description:   "Memory in MiB of a customizable service offering",
+		},
+		"cpu_speed": {
+			Type:          schema.TypeInt,
+			Optional:      true,
+			ConflictsWith: []string{"size"},
+			ValidateFunc:  validation.IntAtLeast(1),
+			Description:   "Speed of the CPUs in MHz of a customizable service offering",
 		},
 		"disk_size": {
 			Type:         schema.TypeInt,
@@ -43,9 +82,11 @@ func computeResource() *schema.Resource {
 			ValidateFunc: validation.IntAtLeast(10),
 		},
 		"zone": {
-			Type:     schema.TypeString,
-			Required: true,
-			ForceNew: true,
+			Type:        schema.TypeString,
+			Optional:    true,
+			Computed:    true,
+			ForceNew:    true,
+			Description: "Name of the Data-Center, the one of the provider by default",
 		},
 		"user_data": {
 			Type:        schema.TypeString,
@@ -87,16 +128,24 @@ func computeResource() *schema.Resource {
 			Description: "Request an IPv6 address on the default NIC",
 		},
 		"ip_address": {
-			Type:     schema.TypeString,
-			Computed: true,
+			Type:         schema.TypeString,
+			Optional:     true,
+			Computed:     true,
+			ForceNew:     true,
+			ValidateFunc: ValidateIPv4String,
+			Description:  "IPv4 address of the default NIC, chosen at deployment",
 		},
 		"gateway": {
 			Type:     schema.TypeString,
 			Computed: true,
 		},
 		"ip6_address": {
-			Type:     schema.TypeString,
-			Computed: true,
+			Type:         schema.TypeString,
+			Optional:     true,
+			Computed:     true,
+			ForceNew:     true,
+			ValidateFunc: ValidateIPv6String,
+			Description:  "IPv6 address of the default NIC, chosen at deployment",
 		},
 		"ip6_cidr": {
 			Type:     schema.TypeString,
@@ -126,6 +175,7 @@ func computeResource() *schema.Resource {
 			Type:          schema.TypeSet,
 			Optional:      true,
 			Computed:      true,
+			MinItems:      1,
 			Set:           schema.HashString,
 			ConflictsWith: []string{"security_groups"},
 			Elem: &schema.Schema{
@@ -136,12 +186,50 @@ func computeResource() *schema.Resource {
 			Type:          schema.TypeSet,
 			Optional:      true,
 			Computed:      true,
+			MinItems:      1,
 			Set:           schema.HashString,
 			ConflictsWith: []string{"security_group_ids"},
 			Elem: &schema.Schema{
 				Type: schema.TypeString,
 			},
 		},
+		"reboot_triggers": {
+			Type:        schema.TypeMap,
+			Optional:    true,
+			Description: "Arbitrary values whose changes reboot the running instance",
+		},
+		"force_stop": {
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Default:     false,
+			Description: "Stop the instance without waiting for the guest to shut down",
+		},
+		"stop_timeout": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			Default:      0,
+			ValidateFunc: validation.IntAtLeast(0),
+			Description:  "Seconds given to the guest to shut down before a forced stop (by default: no limit)",
+		},
+		"pending_reboot": {
+			Type:        schema.TypeBool,
+			Computed:    true,
+			Description: "Whether the planned changes restart the running instance",
+		},
+		"ha_enabled": {
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Computed:    true,
+			Description: "Restart the instance on another host, should its host fail",
+		},
+		"host_id": {
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+		"hypervisor": {
+			Type:     schema.TypeString,
+			Computed: true,
+		},
 		"username": {
 			Type:     schema.TypeString,
 			Computed: true,
@@ -162,6 +250,8 @@ func computeResource() *schema.Resource {
 		Update: updateCompute,
 		Delete: deleteCompute,
 
+		CustomizeDiff: customizeDiffCompute,
+
 		Importer: &schema.ResourceImporter{
 			State: importCompute,
 		},
@@ -184,74 +274,40 @@ func createCompute(d *schema.ResourceData, meta interface{}) error {
 	client := GetComputeClient(meta)
 
 	displayName := d.Get("display_name").(string)
-	hostName := regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9\\-]+$")
-	if !hostName.MatchString(displayName) {
-		return fmt.Errorf("At creation time, the `display_name` must match a value compatible with the `hostname` (alpha-numeric and hyphens")
+	hostname := d.Get("hostname").(string)
+	if hostname == "" {
+		if _, es := ValidateHostnameString(displayName, "display_name"); len(es) == 0 {
+			hostname = displayName
+		}
 	}
 
 	// ServiceOffering
 	size := d.Get("size").(string)
-	resp, err := client.RequestWithContext(ctx, &egoscale.ListServiceOfferings{
-		Name: size,
-	})
-	if err != nil {
-		return err
+	cpu := d.Get("cpu").(int)
+	memory := d.Get("memory").(int)
+	if cpu != 0 || memory != 0 || d.Get("cpu_speed").(int) != 0 {
+		size = ""
+	} else if size == "" {
+		size = defaultComputeSize
 	}
 
-	services := resp.(*egoscale.ListServiceOfferingsResponse)
-	if len(services.ServiceOffering) != 1 {
-		return fmt.Errorf("Unable to find the size: %#v", size)
+	service, offeringDetails, err := getServiceOffering(ctx, client, size, cpu, memory, d.Get("cpu_speed").(int))
+	if err != nil {
+		return err
 	}
-	service := services.ServiceOffering[0].ID
 
 	// XXX Use Generic Get...
-	zoneName := d.Get("zone").(string)
-	zone, err := getZoneByName(ctx, client, zoneName)
+	zone, err := getZone(ctx, d, meta)
 	if err != nil {
 		return err
 	}
 
 	diskSize := int64(d.Get("disk_size").(int))
-	resp, err = client.RequestWithContext(ctx, &egoscale.ListTemplates{
-		TemplateFilter: "featured",
-		ZoneID:         zone.ID,
-	})
+	templateID, username, err := getTemplate(ctx, client, zone.ID, d.Get("template").(string), diskSize)
 	if err != nil {
 		return err
 	}
 
-	var templateID *egoscale.UUID
-	username := ""
-	currentDiskSize := diskSize << 30 // Gib to B
-	image := strings.ToLower(d.Get("template").(string))
-
-	for _, template := range resp.(*egoscale.ListTemplatesResponse).Template {
-		// Skip non-machine images
-		if strings.ToLower(template.Name) != image {
-			continue
-		}
-
-		if name, ok := template.Details["username"]; username == "" && ok {
-			username = name
-		}
-
-		// Pick the smallest disk size
-		if template.Size <= currentDiskSize {
-			currentDiskSize = template.Size
-			templateID = template.ID
-			continue
-		}
-	}
-
-	if templateID == nil {
-		return fmt.Errorf("Template not found: %s (%dGB Disk)", d.Get("template").(string), d.Get("disk_size").(int))
-	}
-
-	if username == "" {
-		log.Printf("[INFO] Username not found in the template details, falling back to root.")
-		username = "root"
-	}
-
 	// Affinity Groups
 	var affinityGroups []string
 	if affinitySet, ok := d.Get("affinity_groups").(*schema.Set); ok {
@@ -305,9 +361,12 @@ func createCompute(d *schema.ResourceData, meta interface{}) error {
 	details := make(map[string]string)
 	details["ip4"] = strconv.FormatBool(d.Get("ip4").(bool))
 	details["ip6"] = strconv.FormatBool(d.Get("ip6").(bool))
+	for k, v := range offeringDetails {
+		details[k] = v
+	}
 
 	req := &egoscale.DeployVirtualMachine{
-		Name:               displayName,
+		Name:               hostname,
 		DisplayName:        displayName,
 		RootDiskSize:       int64(diskSize),
 		KeyPair:            d.Get("key_pair").(string),
@@ -324,7 +383,14 @@ func createCompute(d *schema.ResourceData, meta interface{}) error {
 		StartVM:            &startVM,
 	}
 
-	resp, err = client.RequestWithContext(ctx, req)
+	if ip, ok := d.GetOk("ip_address"); ok {
+		req.IPAddress = net.ParseIP(ip.(string))
+	}
+	if ip6, ok := d.GetOk("ip6_address"); ok {
+		req.IP6Address = net.ParseIP(ip6.(string))
+	}
+
+	resp, err := client.RequestWithContext(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -349,6 +415,17 @@ func createCompute(d *schema.ResourceData, meta interface{}) error {
 		}
 	}
 
+	// High availability isn't a deployment parameter
+	if ha, ok := d.GetOkExists("ha_enabled"); ok && ha.(bool) != machine.HAEnable {
+		enabled := ha.(bool)
+		if _, err := client.RequestWithContext(ctx, &egoscale.UpdateVirtualMachine{
+			ID:       machine.ID,
+			HAEnable: &enabled,
+		}); err != nil {
+			return err
+		}
+	}
+
 	// Connection info
 	password := ""
 	if machine.PasswordEnabled {
@@ -361,6 +438,150 @@ func createCompute(d *schema.ResourceData, meta interface{}) error {
 	return readCompute(d, meta)
 }
 
+// rebootKeys are the arguments whose changes restart a running instance
+var rebootKeys = []string{
+	"template",
+	"hostname",
+	"user_data",
+	"size",
+	"cpu",
+	"memory",
+	"cpu_speed",
+	"disk_size",
+	"affinity_groups",
+	"affinity_group_ids",
+	"reboot_triggers",
+}
+
+// customizeDiffCompute checks the update constraints at plan time
+//
+// A customizable offering needs both cpu and memory, and a disk shrink is
+// rejected as recreating the instance would lose its data. The deactivation
+// of IPv4 or IPv6 recreates the instance, the empty security groups being
+// rejected by the schema. It also tells whether the changes restart the
+// instance.
+func customizeDiffCompute(d *schema.ResourceDiff, meta interface{}) error {
+	if d.NewValueKnown("cpu") && d.NewValueKnown("memory") && d.NewValueKnown("cpu_speed") {
+		cpu := d.Get("cpu").(int)
+		memory := d.Get("memory").(int)
+		if (cpu == 0) != (memory == 0) {
+			return fmt.Errorf("Both `cpu` and `memory` are required for a customizable service offering")
+		}
+		if d.Get("cpu_speed").(int) != 0 && cpu == 0 {
+			return fmt.Errorf("`cpu_speed` requires both `cpu` and `memory`")
+		}
+	}
+
+	// Without a new size, the instance would keep its customized offering
+	if d.Id() != "" && d.HasChange("cpu") && d.NewValueKnown("cpu") && d.Get("cpu").(int) == 0 && !d.HasChange("size") {
+		return fmt.Errorf("Set `size` when removing `cpu` and `memory`")
+	}
+
+	if d.Id() == "" {
+		if ip6, ok := d.GetOk("ip6_address"); ok && ip6.(string) != "" && !d.Get("ip6").(bool) {
+			return fmt.Errorf("An `ip6_address` requires `ip6` to be activated")
+		}
+		return nil
+	}
+
+	if err := clearDeployedAddresses(d, meta); err != nil {
+		return err
+	}
+
+	forceNew := make([]string, 0)
+
+	if d.HasChange("template") && !d.Get("rebuild_on_template_change").(bool) {
+		forceNew = append(forceNew, "template")
+	}
+
+	if d.HasChange("disk_size") {
+		o, n := d.GetChange("disk_size")
+		if o.(int) > n.(int) {
+			return fmt.Errorf("A volume can only be expanded. From %dG to %dG is not allowed", o.(int), n.(int))
+		}
+	}
+
+	// Neither the IPv4 nor the IPv6 address can be deactivated
+	for _, key := range []string{"ip4", "ip6"} {
+		if d.HasChange(key) && !d.Get(key).(bool) {
+			forceNew = append(forceNew, key)
+		}
+	}
+
+	if len(forceNew) > 0 {
+		for _, key := range forceNew {
+			if err := d.ForceNew(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	o, n := d.GetChange("state")
+	if !strings.EqualFold(o.(string), "Running") || strings.EqualFold(n.(string), "Stopped") {
+		return nil
+	}
+
+	for _, key := range rebootKeys {
+		if d.HasChange(key) {
+			return d.SetNew("pending_reboot", true)
+		}
+	}
+
+	return nil
+}
+
+// clearDeployedAddresses drops the diff of the configured addresses still matching the public NIC
+//
+// The ip_address and ip6_address follow the default NIC while the configured
+// ones were chosen at deployment, hence for the public NIC. Another NIC becoming
+// the default one must not recreate the instance.
+func clearDeployedAddresses(d *schema.ResourceDiff, meta interface{}) error {
+	keys := make([]string, 0, 2)
+	for _, key := range []string{"ip_address", "ip6_address"} {
+		if d.HasChange(key) && d.NewValueKnown(key) && d.Get(key).(string) != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	id, err := egoscale.ParseUUID(d.Id())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), meta.(*BaseConfig).compute.timeout)
+	defer cancel()
+
+	machine := &egoscale.VirtualMachine{ID: id}
+	if err := GetComputeClient(meta).GetWithContext(ctx, machine); err != nil {
+		return err
+	}
+
+	nic := publicNic(machine.Nic)
+	if nic == nil {
+		return nil
+	}
+
+	for _, key := range keys {
+		deployed := nic.IPAddress
+		if key == "ip6_address" {
+			deployed = nic.IP6Address
+		}
+
+		if deployed != nil && deployed.Equal(net.ParseIP(d.Get(key).(string))) {
+			if err := d.Clear(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func existsCompute(d *schema.ResourceData, meta interface{}) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutRead))
 	defer cancel()
@@ -507,6 +728,17 @@ func updateCompute(d *schema.ResourceData, meta interface{}) error {
 		req.DisplayName = d.Get("display_name").(string)
 	}
 
+	if d.HasChange("ha_enabled") {
+		enabled := d.Get("ha_enabled").(bool)
+		req.HAEnable = &enabled
+	}
+
+	// The new hostname is applied on the next start
+	if d.HasChange("hostname") {
+		req.Name = d.Get("hostname").(string)
+		rebootRequired = true
+	}
+
 	if d.HasChange("user_data") {
 		userData, err := prepareUserData(d, meta, "user_data")
 		if err != nil {
@@ -518,8 +750,6 @@ func updateCompute(d *schema.ResourceData, meta interface{}) error {
 	}
 
 	if d.HasChange("security_groups") {
-		rebootRequired = true
-
 		securityGroupIDs := make([]egoscale.UUID, 0)
 		if securitySet, ok := d.Get("security_groups").(*schema.Set); ok {
 			for _, group := range securitySet.List() {
@@ -531,14 +761,8 @@ func updateCompute(d *schema.ResourceData, meta interface{}) error {
 			}
 		}
 
-		if len(securityGroupIDs) == 0 {
-			return fmt.Errorf("A VM must have at least one Security Group, none found")
-		}
-
 		req.SecurityGroupIDs = securityGroupIDs
 	} else if d.HasChange("security_group_ids") {
-		rebootRequired = true
-
 		securityGroupIDs := make([]egoscale.UUID, 0)
 		if securitySet, ok := d.Get("security_group_ids").(*schema.Set); ok {
 			for _, group := range securitySet.List() {
@@ -550,22 +774,33 @@ func updateCompute(d *schema.ResourceData, meta interface{}) error {
 			}
 		}
 
-		if len(securityGroupIDs) == 0 {
-			return fmt.Errorf("A VM must have at least one Security Group, none found")
-		}
-
 		req.SecurityGroupIDs = securityGroupIDs
 	}
 
-	if d.HasChange("disk_size") {
-		o, n := d.GetChange("disk_size")
-		oldSize := o.(int)
-		newSize := n.(int)
+	// The template change reimages the root disk, with its new size
+	var restore *egoscale.RestoreVirtualMachine
+	username := ""
+	if d.HasChange("template") {
+		zone, err := getZone(ctx, d, meta)
+		if err != nil {
+			return err
+		}
 
-		if oldSize > newSize {
-			return fmt.Errorf("A volume can only be expanded. From %dG to %dG is not allowed", oldSize, newSize)
+		diskSize := int64(d.Get("disk_size").(int))
+		templateID, name, err := getTemplate(ctx, client, zone.ID, d.Get("template").(string), diskSize)
+		if err != nil {
+			return err
+		}
+
+		restore = &egoscale.RestoreVirtualMachine{
+			VirtualMachineID: id,
+			TemplateID:       templateID,
+			RootDiskSize:     diskSize,
 		}
+		username = name
+	}
 
+	if d.HasChange("disk_size") && restore == nil {
 		rebootRequired = true
 
 		volumes, err := client.ListWithContext(ctx, &egoscale.Volume{
@@ -588,33 +823,40 @@ func updateCompute(d *schema.ResourceData, meta interface{}) error {
 		})
 	}
 
-	if d.HasChange("size") {
+	// Going back to a named size unsets cpu and memory
+	if d.Get("cpu").(int) != 0 && (d.HasChange("cpu") || d.HasChange("memory") || d.HasChange("cpu_speed")) {
+		rebootRequired = true
+
+		service, details, err := getServiceOffering(ctx, client, "", d.Get("cpu").(int), d.Get("memory").(int), d.Get("cpu_speed").(int))
+		if err != nil {
+			return err
+		}
+
+		commands = append(commands, partialCommand{
+			partials: []string{"size", "cpu", "memory", "cpu_speed"},
+			request: &egoscale.ScaleVirtualMachine{
+				ID:                id,
+				ServiceOfferingID: service,
+				Details:           details,
+			},
+		})
+	} else if d.HasChange("size") {
 		o, n := d.GetChange("size")
 		oldSize := o.(string)
 		newSize := n.(string)
-		if strings.ToLower(oldSize) != strings.ToLower(newSize) {
+		if newSize != "" && strings.ToLower(oldSize) != strings.ToLower(newSize) {
 			rebootRequired = true
-			resp, err := client.RequestWithContext(ctx, &egoscale.ListServiceOfferings{
-				Name: newSize,
-			})
+
+			service, _, err := getServiceOffering(ctx, client, newSize, 0, 0, 0)
 			if err != nil {
 				return err
 			}
 
-			services, ok := resp.(*egoscale.ListServiceOfferingsResponse)
-			if !ok {
-				return fmt.Errorf("wrong type, a ListServiceOfferingsResponse was expected, got %T", resp)
-			}
-
-			if len(services.ServiceOffering) != 1 {
-				return fmt.Errorf("size %q was not found", newSize)
-			}
-
 			commands = append(commands, partialCommand{
-				partial: "size",
+				partials: []string{"size", "cpu", "memory", "cpu_speed"},
 				request: &egoscale.ScaleVirtualMachine{
 					ID:                id,
-					ServiceOfferingID: services.ServiceOffering[0].ID,
+					ServiceOfferingID: service,
 				},
 			})
 		}
@@ -622,13 +864,6 @@ func updateCompute(d *schema.ResourceData, meta interface{}) error {
 
 	if d.HasChange("affinity_groups") {
 		rebootRequired = true
-		o, n := d.GetChange("affinity_groups")
-		if o.(*schema.Set).Len() >= n.(*schema.Set).Len() {
-			return fmt.Errorf("Affinity Groups cannot be added.")
-		}
-		if n.(*schema.Set).Difference(o.(*schema.Set)).Len() > 0 {
-			return fmt.Errorf("No new Affinity Groups can be added.")
-		}
 
 		if affinitySet, ok := d.Get("affinity_groups").(*schema.Set); ok {
 			affinityGroups := make([]string, affinitySet.Len())
@@ -645,13 +880,6 @@ func updateCompute(d *schema.ResourceData, meta interface{}) error {
 		}
 	} else if d.HasChange("affinity_group_ids") {
 		rebootRequired = true
-		o, n := d.GetChange("affinity_group_ids")
-		if o.(*schema.Set).Len() >= n.(*schema.Set).Len() {
-			return fmt.Errorf("Affinity Groups cannot be added.")
-		}
-		if n.(*schema.Set).Difference(o.(*schema.Set)).Len() > 0 {
-			return fmt.Errorf("No new Affinity Groups can be added.")
-		}
 
 		if affinitySet, ok := d.Get("affinity_group_ids").(*schema.Set); ok {
 			affinityGroups := make([]egoscale.UUID, affinitySet.Len())
@@ -683,37 +911,25 @@ func updateCompute(d *schema.ResourceData, meta interface{}) error {
 		})
 	}
 
-	if d.HasChange("ip4") {
-		activateIP4 := d.Get("ip4").(bool)
-		if !activateIP4 {
-			return fmt.Errorf("The IPv4 address cannot be deactivated")
+	if d.HasChange("ip6") && d.Get("ip6").(bool) {
+		resp, err := client.Request(&egoscale.ListNics{
+			VirtualMachineID: id,
+		})
+		if err != nil {
+			return err
 		}
-	}
-
-	if d.HasChange("ip6") {
-		activateIP6 := d.Get("ip6").(bool)
-		if activateIP6 {
-			resp, err := client.Request(&egoscale.ListNics{
-				VirtualMachineID: id,
-			})
-			if err != nil {
-				return err
-			}
-
-			nics := resp.(*egoscale.ListNicsResponse)
-			if len(nics.Nic) == 0 {
-				return fmt.Errorf("The VM has no NIC %v", d.Id())
-			}
 
-			commands = append(commands, partialCommand{
-				partials: []string{"ip6", "ip6_address", "ip6_cidr"},
-				request: &egoscale.ActivateIP6{
-					NicID: nics.Nic[0].ID,
-				},
-			})
-		} else {
-			return fmt.Errorf("The IPv6 address cannot be deactivated")
+		nic := publicNic(resp.(*egoscale.ListNicsResponse).Nic)
+		if nic == nil {
+			return fmt.Errorf("The VM has no NIC %v", d.Id())
 		}
+
+		commands = append(commands, partialCommand{
+			partials: []string{"ip6", "ip6_address", "ip6_cidr"},
+			request: &egoscale.ActivateIP6{
+				NicID: nic.ID,
+			},
+		})
 	}
 
 	if d.HasChange("state") {
@@ -729,21 +945,50 @@ func updateCompute(d *schema.ResourceData, meta interface{}) error {
 		}
 	}
 
+	// The security groups of a running instance are changed live, on their
+	// own, as the plan doesn't expect any restart. When the platform refuses
+	// it, they are changed while the instance is stopped.
+	if req.SecurityGroupIDs != nil && initialState == "Running" && !rebootRequired && !stopRequired {
+		_, err := client.RequestWithContext(ctx, &egoscale.UpdateVirtualMachine{
+			ID:               id,
+			SecurityGroupIDs: req.SecurityGroupIDs,
+		})
+		if err == nil {
+			req.SecurityGroupIDs = nil
+			d.SetPartial("security_groups")
+			d.SetPartial("security_group_ids")
+		} else {
+			log.Printf("[WARN] the security groups of VM %s cannot be changed while running, restarting it: %s", d.Id(), err)
+			rebootRequired = true
+			d.Set("pending_reboot", true)
+			d.SetPartial("pending_reboot")
+		}
+	}
+
+	// A stop and start already reboots the instance
+	if d.HasChange("reboot_triggers") && initialState == "Running" && !rebootRequired && !stopRequired {
+		commands = append(commands, partialCommand{
+			partial: "reboot_triggers",
+			request: &egoscale.RebootVirtualMachine{
+				ID: id,
+			},
+		})
+	}
+
 	// Stop
 	if initialState != "Stopped" && (rebootRequired || stopRequired) {
-		resp, err := client.RequestWithContext(ctx, &egoscale.StopVirtualMachine{
-			ID: id,
-		})
+		m, err := stopCompute(ctx, client, d, id)
 		if err != nil {
 			return err
 		}
 
-		m := resp.(*egoscale.VirtualMachine)
 		if err := applyCompute(d, m); err != nil {
 			return err
 		}
 		d.SetPartial("state")
 	}
+	d.SetPartial("force_stop")
+	d.SetPartial("stop_timeout")
 
 	// Update, we ignore the result as a full read is require for the user-data/volume
 	_, err = client.RequestWithContext(ctx, req)
@@ -756,7 +1001,30 @@ func updateCompute(d *schema.ResourceData, meta interface{}) error {
 	}
 	d.SetPartial("user_data")
 	d.SetPartial("display_name")
+	d.SetPartial("hostname")
+	d.SetPartial("ha_enabled")
 	d.SetPartial("security_groups")
+	d.SetPartial("security_group_ids")
+
+	if restore != nil {
+		resp, err := client.RequestWithContext(ctx, restore)
+		if err != nil {
+			return err
+		}
+
+		// The password of the new template, if any
+		password := ""
+		if m := resp.(*egoscale.VirtualMachine); m.PasswordEnabled {
+			password = m.Password
+		}
+		d.Set("username", username)
+		d.Set("password", password)
+
+		d.SetPartial("template")
+		d.SetPartial("disk_size")
+		d.SetPartial("username")
+		d.SetPartial("password")
+	}
 
 	if (initialState == "Running" && rebootRequired) || startRequired {
 		commands = append(commands, partialCommand{
@@ -789,6 +1057,54 @@ func updateCompute(d *schema.ResourceData, meta interface{}) error {
 	return err
 }
 
+// stopCompute stops the instance, forcing it when asked or after the stop timeout
+func stopCompute(ctx context.Context, client *egoscale.Client, d *schema.ResourceData, id *egoscale.UUID) (*egoscale.VirtualMachine, error) {
+	forced := d.Get("force_stop").(bool)
+	stopCtx := ctx
+	if timeout := d.Get("stop_timeout").(int); timeout > 0 && !forced {
+		var cancel context.CancelFunc
+		stopCtx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	resp, err := client.RequestWithContext(stopCtx, &egoscale.StopVirtualMachine{
+		ID:     id,
+		Forced: &forced,
+	})
+	if err != nil {
+		if forced || ctx.Err() != nil || stopCtx.Err() != context.DeadlineExceeded {
+			return nil, err
+		}
+
+		// The stop job is still running on the platform, hence the instance
+		// is only forced when it's still up
+		machine := &egoscale.VirtualMachine{ID: id}
+		if err := client.GetWithContext(ctx, machine); err != nil {
+			return nil, err
+		}
+
+		switch machine.State {
+		case "Stopped":
+			return machine, nil
+		case "Running", "Stopping":
+		default:
+			return nil, fmt.Errorf("VM %s didn't stop within %ds, got %s", id, d.Get("stop_timeout").(int), machine.State)
+		}
+
+		log.Printf("[INFO] VM %s didn't stop within %ds, forcing it", id, d.Get("stop_timeout").(int))
+		forced = true
+		resp, err = client.RequestWithContext(ctx, &egoscale.StopVirtualMachine{
+			ID:     id,
+			Forced: &forced,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp.(*egoscale.VirtualMachine), nil
+}
+
 func deleteCompute(d *schema.ResourceData, meta interface{}) error {
 	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
 	defer cancel()
@@ -879,12 +1195,28 @@ func importCompute(d *schema.ResourceData, meta interface{}) ([]*schema.Resource
 
 func applyCompute(d *schema.ResourceData, machine *egoscale.VirtualMachine) error {
 	d.Set("name", machine.Name)
+	d.Set("hostname", machine.Name)
 	d.Set("display_name", machine.DisplayName)
 	d.Set("key_pair", machine.KeyPair)
 	d.Set("size", machine.ServiceOfferingName)
+	// The resources are only tracked when set, i.e. with a customizable offering
+	if d.Get("cpu").(int) != 0 || d.Get("memory").(int) != 0 {
+		d.Set("cpu", machine.CPUNumber)
+		d.Set("memory", machine.Memory)
+	}
+	if d.Get("cpu_speed").(int) != 0 {
+		d.Set("cpu_speed", machine.CPUSpeed)
+	}
 	d.Set("template", machine.TemplateName)
 	d.Set("zone", machine.ZoneName)
 	d.Set("state", machine.State)
+	d.Set("ha_enabled", machine.HAEnable)
+	d.Set("pending_reboot", false)
+	d.Set("hypervisor", machine.Hypervisor)
+	d.Set("host_id", "")
+	if machine.HostID != nil {
+		d.Set("host_id", machine.HostID.String())
+	}
 
 	d.Set("ip4", false)
 	d.Set("ip6", false)
@@ -893,7 +1225,6 @@ func applyCompute(d *schema.ResourceData, machine *egoscale.VirtualMachine) erro
 	d.Set("ip6_address", "")
 	d.Set("ip6_cidr", "")
 	if nic := machine.DefaultNic(); nic != nil {
-		d.Set("ip4", true)
 		if nic.IPAddress != nil {
 			d.Set("ip_address", nic.IPAddress.String())
 		}
@@ -901,7 +1232,6 @@ func applyCompute(d *schema.ResourceData, machine *egoscale.VirtualMachine) erro
 			d.Set("gateway", nic.Gateway.String())
 		}
 		if nic.IP6Address != nil {
-			d.Set("ip6", true)
 			d.Set("ip6_address", nic.IP6Address.String())
 		}
 		if nic.IP6CIDR != nil {
@@ -909,6 +1239,12 @@ func applyCompute(d *schema.ResourceData, machine *egoscale.VirtualMachine) erro
 		}
 	}
 
+	// IPv4 and IPv6 are activated on the public NIC, even when it's not the default one
+	if nic := publicNic(machine.Nic); nic != nil {
+		d.Set("ip4", true)
+		d.Set("ip6", nic.IP6Address != nil)
+	}
+
 	// affinity groups
 	affinityGroups := make([]string, len(machine.AffinityGroup))
 	affinityGroupIDs := make([]egoscale.UUID, len(machine.AffinityGroup))
@@ -952,6 +1288,21 @@ func applyCompute(d *schema.ResourceData, machine *egoscale.VirtualMachine) erro
 	return nil
 }
 
+// publicNic returns the NIC which isn't on a private network, the first one otherwise
+func publicNic(nics []egoscale.Nic) *egoscale.Nic {
+	for i := range nics {
+		if nics[i].Type != "Isolated" {
+			return &nics[i]
+		}
+	}
+
+	if len(nics) > 0 {
+		return &nics[0]
+	}
+
+	return nil
+}
+
 func getSSHUsername(template string) string {
 	name := strings.ToLower(template)
 
@@ -982,6 +1333,100 @@ func getSSHUsername(template string) string {
 	return "root"
 }
 
+// getServiceOffering finds the service offering by name or, without a name,
+// the customizable one with the details giving its CPUs, memory and speed
+func getServiceOffering(ctx context.Context, client *egoscale.Client, name string, cpu, memory, cpuSpeed int) (*egoscale.UUID, map[string]string, error) {
+	if name != "" {
+		resp, err := client.RequestWithContext(ctx, &egoscale.ListServiceOfferings{
+			Name: name,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		services := resp.(*egoscale.ListServiceOfferingsResponse)
+		if len(services.ServiceOffering) != 1 {
+			return nil, nil, fmt.Errorf("Unable to find the size: %#v", name)
+		}
+
+		return services.ServiceOffering[0].ID, nil, nil
+	}
+
+	if cpu == 0 || memory == 0 {
+		return nil, nil, fmt.Errorf("Both `cpu` and `memory` are required for a customizable service offering")
+	}
+
+	resp, err := client.RequestWithContext(ctx, &egoscale.ListServiceOfferings{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, service := range resp.(*egoscale.ListServiceOfferingsResponse).ServiceOffering {
+		if !service.IsCustomized {
+			continue
+		}
+
+		details := map[string]string{
+			"cpuNumber": strconv.Itoa(cpu),
+			"memory":    strconv.Itoa(memory),
+		}
+		if cpuSpeed != 0 {
+			details["cpuSpeed"] = strconv.Itoa(cpuSpeed)
+		}
+
+		return service.ID, details, nil
+	}
+
+	return nil, nil, fmt.Errorf("No customizable service offering found, use `size` instead")
+}
+
+// getTemplate finds the template by name, the one with the smallest disk able to hold the given size (GiB)
+//
+// It also returns the username of the template, root by default.
+func getTemplate(ctx context.Context, client *egoscale.Client, zoneID *egoscale.UUID, name string, diskSize int64) (*egoscale.UUID, string, error) {
+	resp, err := client.RequestWithContext(ctx, &egoscale.ListTemplates{
+		TemplateFilter: "featured",
+		ZoneID:         zoneID,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var templateID *egoscale.UUID
+	username := ""
+	currentDiskSize := diskSize << 30 // Gib to B
+	image := strings.ToLower(name)
+
+	for _, template := range resp.(*egoscale.ListTemplatesResponse).Template {
+		// Skip non-machine images
+		if strings.ToLower(template.Name) != image {
+			continue
+		}
+
+		if name, ok := template.Details["username"]; username == "" && ok {
+			username = name
+		}
+
+		// Pick the smallest disk size
+		if template.Size <= currentDiskSize {
+			currentDiskSize = template.Size
+			templateID = template.ID
+			continue
+		}
+	}
+
+	if templateID == nil {
+		return nil, "", fmt.Errorf("Template not found: %s (%dGB Disk)", name, diskSize)
+	}
+
+	if username == "" {
+		log.Printf("[INFO] Username not found in the template details, falling back to root.")
+		username = "root"
+	}
+
+	return templateID, username, nil
+}
+
 func getSecurityGroup(ctx context.Context, client *egoscale.Client, name string) (*egoscale.SecurityGroup, error) {
 	sg := &egoscale.SecurityGroup{Name: name}
 	err := client.GetWithContext(ctx, sg)
@@ -1005,7 +1450,7 @@ func prepareUserData(d *schema.ResourceData, meta interface{}, key string) (stri
 	if strings.HasPrefix(userData, "#cloud-config") || strings.HasPrefix(userData, "Content-Type: multipart/mixed;") {
 		byteUserData := []byte(userData)
 
-		if meta.(BaseConfig).gzipUserData {
+		if meta.(*BaseConfig).gzipUserData {
 			b := new(bytes.Buffer)
 			gz := gzip.NewWriter(b)
 
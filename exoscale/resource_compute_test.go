@@ -1,10 +1,15 @@
 package exoscale
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/exoscale/egoscale"
+	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/terraform"
 )
@@ -30,13 +35,484 @@ func TestAccCompute(t *testing.T) {
 				Check: resource.ComposeTestCheckFunc(
 					testAccCheckComputeExists("exoscale_compute.vm", vm),
 					testAccCheckComputeAttributes(vm),
-					testAccCheckComputeCreateAttributes("hello"),
+					testAccCheckComputeCreateAttributes("Hello, World!"),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "hostname", "hello"),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "ha_enabled", "true"),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "pending_reboot", "false"),
+					resource.TestCheckResourceAttrSet("exoscale_compute.vm", "hypervisor"),
 				),
 			},
 		},
 	})
 }
 
+func TestAccComputeRebuild(t *testing.T) {
+	vm := new(egoscale.VirtualMachine)
+	var id string
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckComputeDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccComputeRebuild(EXOSCALE_TEMPLATE),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComputeExists("exoscale_compute.vm", vm),
+					func(s *terraform.State) error {
+						id = vm.ID.String()
+						return nil
+					},
+				),
+			},
+			{
+				Config: testAccComputeRebuild(EXOSCALE_REBUILD_TEMPLATE),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComputeExists("exoscale_compute.vm", vm),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "template", EXOSCALE_REBUILD_TEMPLATE),
+					func(s *terraform.State) error {
+						if vm.ID.String() != id {
+							return fmt.Errorf("the instance was expected to be rebuilt in place, got %s instead of %s", vm.ID, id)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccComputeCustomOffering(t *testing.T) {
+	vm := new(egoscale.VirtualMachine)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckComputeDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccComputeCustomOffering(1, 1024),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComputeExists("exoscale_compute.vm", vm),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "cpu", "1"),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "memory", "1024"),
+				),
+			},
+			{
+				Config: testAccComputeCustomOffering(2, 2048),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComputeExists("exoscale_compute.vm", vm),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "cpu", "2"),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "memory", "2048"),
+				),
+			},
+		},
+	})
+}
+
+func TestCustomizeDiffCompute(t *testing.T) {
+	state := &terraform.InstanceState{
+		ID: "eb556678-ec59-4be6-8c54-0406ae0f6da6",
+		Attributes: map[string]string{
+			"id":                         "eb556678-ec59-4be6-8c54-0406ae0f6da6",
+			"template":                   "Linux Ubuntu 18.04 LTS 64-bit",
+			"disk_size":                  "20",
+			"key_pair":                   "me",
+			"state":                      "Running",
+			"ip4":                        "true",
+			"ip6":                        "true",
+			"security_groups.#":          "1",
+			"security_groups.1":          "default",
+			"affinity_groups.#":          "0",
+			"pending_reboot":             "false",
+			"force_stop":                 "false",
+			"stop_timeout":               "0",
+			"rebuild_on_template_change": "false",
+		},
+	}
+
+	tests := []struct {
+		config   map[string]interface{}
+		err      bool
+		forceNew bool
+		reboot   bool
+	}{
+		{map[string]interface{}{}, false, false, false},
+		{map[string]interface{}{"disk_size": 30}, false, false, true},
+		{map[string]interface{}{"disk_size": 10}, true, false, false},
+		{map[string]interface{}{"ip6": false}, false, true, false},
+		{map[string]interface{}{"template": "Linux Debian 9 64-bit"}, false, true, false},
+		{map[string]interface{}{"template": "Linux Debian 9 64-bit", "rebuild_on_template_change": true}, false, false, true},
+		{map[string]interface{}{"affinity_groups": []interface{}{"web"}}, false, false, true},
+		{map[string]interface{}{"security_groups": []interface{}{"default", "web"}}, false, false, false},
+		{map[string]interface{}{"security_groups": []interface{}{}}, true, false, false},
+		{map[string]interface{}{"disk_size": 30, "state": "Stopped"}, false, false, false},
+		{map[string]interface{}{"cpu": 2, "memory": 2048}, false, false, true},
+		{map[string]interface{}{"cpu": 2}, true, false, false},
+		{map[string]interface{}{"memory": 2048}, true, false, false},
+		{map[string]interface{}{"cpu_speed": 2000}, true, false, false},
+	}
+
+	for _, test := range tests {
+		raw := map[string]interface{}{
+			"template":  "Linux Ubuntu 18.04 LTS 64-bit",
+			"disk_size": 20,
+			"key_pair":  "me",
+			"ip6":       true,
+		}
+		for k, v := range test.config {
+			raw[k] = v
+		}
+
+		c, err := config.NewRawConfig(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, errs := computeResource().Validate(terraform.NewResourceConfig(c))
+		diff, err := computeResource().Diff(state, terraform.NewResourceConfig(c), nil)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		if (len(errs) > 0) != test.err {
+			t.Errorf("%v: bad error, got %v", test.config, errs)
+			continue
+		}
+		if len(errs) > 0 {
+			continue
+		}
+
+		if diff.RequiresNew() != test.forceNew {
+			t.Errorf("%v: expected ForceNew to be %t", test.config, test.forceNew)
+		}
+
+		reboot := false
+		if attr, ok := diff.Attributes["pending_reboot"]; ok {
+			reboot = attr.New == "true"
+		}
+		if reboot != test.reboot {
+			t.Errorf("%v: expected pending_reboot to be %t", test.config, test.reboot)
+		}
+	}
+}
+
+func TestCustomizeDiffComputeRemoveCPU(t *testing.T) {
+	state := &terraform.InstanceState{
+		ID: "eb556678-ec59-4be6-8c54-0406ae0f6da6",
+		Attributes: map[string]string{
+			"id":        "eb556678-ec59-4be6-8c54-0406ae0f6da6",
+			"template":  "Linux Ubuntu 18.04 LTS 64-bit",
+			"disk_size": "20",
+			"key_pair":  "me",
+			"state":     "Running",
+			"size":      "Custom",
+			"cpu":       "2",
+			"memory":    "2048",
+		},
+	}
+
+	for size, fails := range map[string]bool{"": true, "Medium": false} {
+		raw := map[string]interface{}{
+			"template":  "Linux Ubuntu 18.04 LTS 64-bit",
+			"disk_size": 20,
+			"key_pair":  "me",
+		}
+		if size != "" {
+			raw["size"] = size
+		}
+
+		c, err := config.NewRawConfig(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		diff, err := computeResource().Diff(state, terraform.NewResourceConfig(c), nil)
+		if (err != nil) != fails {
+			t.Errorf("size %q: bad error, got %v", size, err)
+			continue
+		}
+		if err == nil && diff.Attributes["pending_reboot"].New != "true" {
+			t.Errorf("size %q: expected a reboot", size)
+		}
+	}
+}
+
+func TestCustomizeDiffComputeIP6Address(t *testing.T) {
+	for _, ip6 := range []bool{true, false} {
+		c, err := config.NewRawConfig(map[string]interface{}{
+			"template":    "Linux Ubuntu 18.04 LTS 64-bit",
+			"disk_size":   20,
+			"key_pair":    "me",
+			"ip6":         ip6,
+			"ip6_address": "2001:db8::1",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = computeResource().Diff(nil, terraform.NewResourceConfig(c), nil)
+		if (err != nil) == ip6 {
+			t.Errorf("ip6 = %t: bad error, got %v", ip6, err)
+		}
+	}
+}
+
+func TestCustomizeDiffComputeDeployedAddress(t *testing.T) {
+	// another NIC became the default one
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"listvirtualmachinesresponse": {"count": 1, "virtualmachine": [{
+			"id": "eb556678-ec59-4be6-8c54-0406ae0f6da6",
+			"nic": [
+				{"id": "3a1e1a7e-5b4c-4e0a-9a4e-5e1b0ad6d9e1", "type": "Shared", "isdefault": false, "ipaddress": "159.100.241.10"},
+				{"id": "7d6c7a1c-8c1e-4b6f-a3b0-4f51c5d1e2a3", "type": "Isolated", "isdefault": true, "ipaddress": "10.0.0.10"}
+			]
+		}]}}`) // nolint: errcheck
+	}))
+	defer ts.Close()
+
+	meta := &BaseConfig{
+		credentials: &credentials{key: "EXO", secret: "secret"},
+		compute:     endpointConfig{endpoint: ts.URL, timeout: time.Minute},
+	}
+
+	state := &terraform.InstanceState{
+		ID: "eb556678-ec59-4be6-8c54-0406ae0f6da6",
+		Attributes: map[string]string{
+			"id":         "eb556678-ec59-4be6-8c54-0406ae0f6da6",
+			"template":   "Linux Ubuntu 18.04 LTS 64-bit",
+			"disk_size":  "20",
+			"key_pair":   "me",
+			"state":      "Running",
+			"ip4":        "true",
+			"ip6":        "false",
+			"ip_address": "10.0.0.10",
+		},
+	}
+
+	for ip, forceNew := range map[string]bool{"159.100.241.10": false, "159.100.241.11": true} {
+		c, err := config.NewRawConfig(map[string]interface{}{
+			"template":   "Linux Ubuntu 18.04 LTS 64-bit",
+			"disk_size":  20,
+			"key_pair":   "me",
+			"ip_address": ip,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		diff, err := computeResource().Diff(state, terraform.NewResourceConfig(c), meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff.RequiresNew() != forceNew {
+			t.Errorf("%s: expected ForceNew to be %t", ip, forceNew)
+		}
+	}
+}
+
+func TestStopComputeTimeout(t *testing.T) {
+	vmID := "eb556678-ec59-4be6-8c54-0406ae0f6da6"
+	jobID := "0e5bf6a8-7f4b-4a9b-b2d1-0d4b7c5d1c21"
+
+	for state, forcedStops := range map[string]int{"Stopping": 1, "Stopped": 0} {
+		forced := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			query := r.URL.Query()
+
+			// the first stop never completes
+			switch query.Get("command") {
+			case "stopVirtualMachine":
+				if query.Get("forced") == "true" {
+					forced++
+					fmt.Fprintf(w, `{"stopvirtualmachineresponse": {"jobid": %q, "jobstatus": 1, "jobresult": {"virtualmachine": {"id": %q, "state": "Stopped"}}}}`, jobID, vmID) // nolint: errcheck
+					return
+				}
+				fmt.Fprintf(w, `{"stopvirtualmachineresponse": {"jobid": %q, "jobstatus": 0}}`, jobID) // nolint: errcheck
+			case "queryAsyncJobResult":
+				fmt.Fprintf(w, `{"queryasyncjobresultresponse": {"jobid": %q, "jobstatus": 0}}`, jobID) // nolint: errcheck
+			case "listVirtualMachines":
+				fmt.Fprintf(w, `{"listvirtualmachinesresponse": {"count": 1, "virtualmachine": [{"id": %q, "state": %q}]}}`, vmID, state) // nolint: errcheck
+			default:
+				t.Errorf("unexpected command %s", query.Get("command"))
+			}
+		}))
+
+		meta := &BaseConfig{
+			credentials: &credentials{key: "EXO", secret: "secret"},
+			compute:     endpointConfig{endpoint: ts.URL, timeout: time.Minute},
+		}
+		client := GetComputeClient(meta)
+		client.RetryStrategy = func(int64) time.Duration { return 10 * time.Millisecond }
+
+		d := computeResource().TestResourceData()
+		d.Set("stop_timeout", 1)
+
+		id, err := egoscale.ParseUUID(vmID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		machine, err := stopCompute(context.Background(), client, d, id)
+		ts.Close()
+
+		if err != nil {
+			t.Errorf("%s: no errors were expected, got %s", state, err)
+			continue
+		}
+		if machine.State != "Stopped" {
+			t.Errorf("%s: expected a stopped instance, got %s", state, machine.State)
+		}
+		if forced != forcedStops {
+			t.Errorf("%s: expected %d forced stops, got %d", state, forcedStops, forced)
+		}
+	}
+}
+
+func TestAccComputeAffinityGroups(t *testing.T) {
+	vm := new(egoscale.VirtualMachine)
+	var id string
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckComputeDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccComputeAffinityGroups(`"${exoscale_affinity.a.name}"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComputeExists("exoscale_compute.vm", vm),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "affinity_groups.#", "1"),
+					func(s *terraform.State) error {
+						id = vm.ID.String()
+						return nil
+					},
+				),
+			},
+			{
+				// add
+				Config: testAccComputeAffinityGroups(`"${exoscale_affinity.a.name}", "${exoscale_affinity.b.name}"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComputeExists("exoscale_compute.vm", vm),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "affinity_groups.#", "2"),
+				),
+			},
+			{
+				// swap
+				Config: testAccComputeAffinityGroups(`"${exoscale_affinity.b.name}"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComputeExists("exoscale_compute.vm", vm),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "affinity_groups.#", "1"),
+					func(s *terraform.State) error {
+						if vm.ID.String() != id {
+							return fmt.Errorf("the instance was expected to be updated in place, got %s instead of %s", vm.ID, id)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccComputeSecurityGroups(t *testing.T) {
+	vm := new(egoscale.VirtualMachine)
+	stops := 0
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckComputeDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccComputeSecurityGroups(`"${exoscale_security_group.a.id}"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComputeExists("exoscale_compute.vm", vm),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "security_group_ids.#", "1"),
+					testAccCountComputeEvents("VM.STOP", &stops),
+				),
+			},
+			{
+				// changed live, without any restart
+				Config: testAccComputeSecurityGroups(`"${exoscale_security_group.a.id}", "${exoscale_security_group.b.id}"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComputeExists("exoscale_compute.vm", vm),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "security_group_ids.#", "2"),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "state", "Running"),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "pending_reboot", "false"),
+					testAccCheckComputeEvents("VM.STOP", &stops, 0),
+				),
+			},
+		},
+	})
+}
+
+func TestAccComputeRebootTriggers(t *testing.T) {
+	vm := new(egoscale.VirtualMachine)
+	stops := 0
+	reboots := 0
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckComputeDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccComputeRebootTriggers("v1"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComputeExists("exoscale_compute.vm", vm),
+					testAccCountComputeEvents("VM.STOP", &stops),
+					testAccCountComputeEvents("VM.REBOOT", &reboots),
+				),
+			},
+			{
+				// rebooted, without any stop
+				Config: testAccComputeRebootTriggers("v2"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComputeExists("exoscale_compute.vm", vm),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "reboot_triggers.version", "v2"),
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "state", "Running"),
+					testAccCheckComputeEvents("VM.REBOOT", &reboots, 1),
+					testAccCheckComputeEvents("VM.STOP", &stops, 0),
+				),
+			},
+		},
+	})
+}
+
+// testAccCountComputeEvents records the number of events of the given type, e.g. VM.STOP
+func testAccCountComputeEvents(eventType string, count *int) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		client := GetComputeClient(testAccProvider.Meta())
+
+		resp, err := client.Request(&egoscale.ListEvents{Type: eventType})
+		if err != nil {
+			return err
+		}
+
+		*count = resp.(*egoscale.ListEventsResponse).Count
+		return nil
+	}
+}
+
+// testAccCheckComputeEvents checks the number of events of the given type since the count
+func testAccCheckComputeEvents(eventType string, count *int, expected int) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		previous := *count
+		if err := testAccCountComputeEvents(eventType, count)(s); err != nil {
+			return err
+		}
+
+		if *count-previous != expected {
+			return fmt.Errorf("expected %d %s events, got %d", expected, eventType, *count-previous)
+		}
+		return nil
+	}
+}
+
 func testAccCheckComputeExists(n string, vm *egoscale.VirtualMachine) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
 		rs, ok := s.RootModule().Resources[n]
@@ -154,7 +630,8 @@ resource "exoscale_ssh_keypair" "key" {
 }
 
 resource "exoscale_compute" "vm" {
-  display_name = "hello"
+  display_name = "Hello, World!"
+  hostname = "hello"
   template = %q
   zone = %q
   size = "Small"
@@ -162,6 +639,12 @@ resource "exoscale_compute" "vm" {
   key_pair = "${exoscale_ssh_keypair.key.name}"
 
   ip6 = true
+  ha_enabled = true
+  stop_timeout = 120
+
+  reboot_triggers {
+    version = "1"
+  }
 
   timeouts {
     delete = "30m"
@@ -171,3 +654,135 @@ resource "exoscale_compute" "vm" {
 	EXOSCALE_TEMPLATE,
 	EXOSCALE_ZONE,
 )
+
+func testAccComputeRebuild(template string) string {
+	return fmt.Sprintf(`
+resource "exoscale_ssh_keypair" "key" {
+  name = "terraform-test-keypair"
+}
+
+resource "exoscale_compute" "vm" {
+  display_name = "terraform-test-rebuild"
+  template = %q
+  zone = %q
+  size = "Micro"
+  disk_size = "12"
+  key_pair = "${exoscale_ssh_keypair.key.name}"
+
+  rebuild_on_template_change = true
+}
+`,
+		template,
+		EXOSCALE_ZONE,
+	)
+}
+
+func testAccComputeCustomOffering(cpu, memory int) string {
+	return fmt.Sprintf(`
+resource "exoscale_ssh_keypair" "key" {
+  name = "terraform-test-keypair"
+}
+
+resource "exoscale_compute" "vm" {
+  display_name = "terraform-test-custom"
+  template = %q
+  zone = %q
+  cpu = %d
+  memory = %d
+  disk_size = "12"
+  key_pair = "${exoscale_ssh_keypair.key.name}"
+}
+`,
+		EXOSCALE_TEMPLATE,
+		EXOSCALE_ZONE,
+		cpu,
+		memory,
+	)
+}
+
+func testAccComputeAffinityGroups(groups string) string {
+	return fmt.Sprintf(`
+resource "exoscale_ssh_keypair" "key" {
+  name = "terraform-test-keypair"
+}
+
+resource "exoscale_affinity" "a" {
+  name = "terraform-test-affinity-a"
+}
+
+resource "exoscale_affinity" "b" {
+  name = "terraform-test-affinity-b"
+}
+
+resource "exoscale_compute" "vm" {
+  display_name = "terraform-test-affinity"
+  template = %q
+  zone = %q
+  size = "Micro"
+  disk_size = "12"
+  key_pair = "${exoscale_ssh_keypair.key.name}"
+
+  affinity_groups = [%s]
+}
+`,
+		EXOSCALE_TEMPLATE,
+		EXOSCALE_ZONE,
+		groups,
+	)
+}
+
+func testAccComputeSecurityGroups(groups string) string {
+	return fmt.Sprintf(`
+resource "exoscale_ssh_keypair" "key" {
+  name = "terraform-test-keypair"
+}
+
+resource "exoscale_security_group" "a" {
+  name = "terraform-test-security-group-a"
+}
+
+resource "exoscale_security_group" "b" {
+  name = "terraform-test-security-group-b"
+}
+
+resource "exoscale_compute" "vm" {
+  display_name = "terraform-test-security-groups"
+  template = %q
+  zone = %q
+  size = "Micro"
+  disk_size = "12"
+  key_pair = "${exoscale_ssh_keypair.key.name}"
+
+  security_group_ids = [%s]
+}
+`,
+		EXOSCALE_TEMPLATE,
+		EXOSCALE_ZONE,
+		groups,
+	)
+}
+
+func testAccComputeRebootTriggers(version string) string {
+	return fmt.Sprintf(`
+resource "exoscale_ssh_keypair" "key" {
+  name = "terraform-test-keypair"
+}
+
+resource "exoscale_compute" "vm" {
+  display_name = "terraform-test-reboot-triggers"
+  template = %q
+  zone = %q
+  size = "Micro"
+  disk_size = "12"
+  key_pair = "${exoscale_ssh_keypair.key.name}"
+
+  reboot_triggers {
+    version = %q
+  }
+}
+`,
+		EXOSCALE_TEMPLATE,
+		EXOSCALE_ZONE,
+		version,
+	)
+}
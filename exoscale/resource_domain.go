@@ -1,6 +1,10 @@
 package exoscale
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/exoscale/egoscale"
 	"github.com/hashicorp/terraform/helper/schema"
 )
@@ -10,12 +14,15 @@ func domainResource() *schema.Resource {
 		Create: createDomain,
 		Exists: existsDomain,
 		Read:   readDomain,
+		Update: updateDomain,
 		Delete: deleteDomain,
 
 		Importer: &schema.ResourceImporter{
 			State: importDomain,
 		},
 
+		CustomizeDiff: customizeDiffDomain,
+
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Type:     schema.TypeString,
@@ -31,13 +38,74 @@ func domainResource() *schema.Resource {
 				Computed: true,
 			},
 			"auto_renew": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Computed:    true,
+				Description: "Renew the registration of the domain automatically",
+			},
+			"expires_on": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"unicode_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"registrant_id": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"language": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"lockable": {
 				Type:     schema.TypeBool,
 				Computed: true,
 			},
-			"expires_on": {
+			"whois_protected": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"record_count": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"service_count": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"created_at": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"updated_at": {
 				Type:     schema.TypeString,
 				Computed: true,
 			},
+			"authoritative": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Remove the records which are not listed in managed_records",
+			},
+			"managed_records": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Set:         schema.HashString,
+				Description: "Names and types of the records managed by other resources as <name>/<record type>, @ being the domain itself",
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateRecordKey,
+				},
+			},
+			"unmanaged_records": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
 		},
 	}
 }
@@ -51,6 +119,13 @@ func createDomain(d *schema.ResourceData, meta interface{}) error {
 	}
 
 	d.SetId(domain.Name)
+
+	if autoRenew, ok := d.GetOkExists("auto_renew"); ok && autoRenew.(bool) != domain.AutoRenew {
+		if err := setDomainAutoRenew(meta, domain.Name, autoRenew.(bool)); err != nil {
+			return err
+		}
+	}
+
 	return readDomain(d, meta)
 }
 
@@ -59,12 +134,13 @@ func existsDomain(d *schema.ResourceData, meta interface{}) (bool, error) {
 
 	_, err := client.GetDomain(d.Id())
 	if err != nil {
-		if _, ok := err.(*egoscale.DNSErrorResponse); ok {
+		if isNotFoundError(err) {
 			return false, nil
 		}
+		return false, err
 	}
 
-	return err == nil, err
+	return true, nil
 }
 
 func readDomain(d *schema.ResourceData, meta interface{}) error {
@@ -72,21 +148,84 @@ func readDomain(d *schema.ResourceData, meta interface{}) error {
 
 	domain, err := client.GetDomain(d.Id())
 	if err != nil {
+		return handleNotFound(d, err)
+	}
+
+	if err := applyDomain(d, *domain); err != nil {
 		return err
 	}
 
-	return applyDomain(d, *domain)
+	unmanaged := make(map[string]interface{})
+	if d.Get("authoritative").(bool) {
+		records, err := client.GetRecords(d.Id())
+		if err != nil {
+			return err
+		}
+
+		managed := managedRecordKeys(d.Get("managed_records").(*schema.Set))
+		for _, record := range records {
+			key := managedRecordKey(record.Name, record.RecordType)
+			if isDefaultRecord(record) || managed[key] {
+				continue
+			}
+
+			unmanaged[strconv.FormatInt(record.ID, 10)] = fmt.Sprintf("%s %s", key, record.Content)
+		}
+	}
+
+	return d.Set("unmanaged_records", unmanaged)
+}
+
+func updateDomain(d *schema.ResourceData, meta interface{}) error {
+	client := GetDNSClient(meta)
+
+	if d.HasChange("auto_renew") {
+		if err := setDomainAutoRenew(meta, d.Id(), d.Get("auto_renew").(bool)); err != nil {
+			return err
+		}
+	}
+
+	// Only the records shown in the plan are removed
+	if d.Get("authoritative").(bool) {
+		o, _ := d.GetChange("unmanaged_records")
+		managed := managedRecordKeys(d.Get("managed_records").(*schema.Set))
+
+		for key := range o.(map[string]interface{}) {
+			id, err := strconv.ParseInt(key, 10, 64)
+			if err != nil {
+				return err
+			}
+
+			record, err := client.GetRecord(d.Id(), id)
+			if err != nil {
+				if isNotFoundError(err) {
+					continue
+				}
+				return err
+			}
+
+			if managed[managedRecordKey(record.Name, record.RecordType)] {
+				continue
+			}
+
+			if err := client.DeleteRecord(d.Id(), id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return readDomain(d, meta)
 }
 
 func deleteDomain(d *schema.ResourceData, meta interface{}) error {
 	client := GetDNSClient(meta)
 
-	err := client.DeleteDomain(d.Id())
-	if err != nil {
-		d.SetId("")
+	if err := client.DeleteDomain(d.Id()); err != nil && !isNotFoundError(err) {
+		return err
 	}
 
-	return err
+	d.SetId("")
+	return nil
 }
 
 func importDomain(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
@@ -110,7 +249,7 @@ func importDomain(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceD
 
 	for _, record := range records {
 		// Ignore the default NS and SOA entries
-		if record.RecordType == "NS" || record.RecordType == "SOA" {
+		if isDefaultRecord(record) {
 			continue
 		}
 		resource := domainRecordResource()
@@ -134,6 +273,106 @@ func applyDomain(d *schema.ResourceData, domain egoscale.DNSDomain) error {
 	d.Set("token", domain.Token)
 	d.Set("auto_renew", domain.AutoRenew)
 	d.Set("expires_on", domain.ExpiresOn)
+	d.Set("unicode_name", domain.UnicodeName)
+	d.Set("registrant_id", int(domain.RegistrantID))
+	d.Set("language", domain.Language)
+	d.Set("lockable", domain.Lockable)
+	d.Set("whois_protected", domain.WhoisProtected)
+	d.Set("record_count", int(domain.RecordCount))
+	d.Set("service_count", int(domain.ServiceCount))
+	d.Set("created_at", domain.CreatedAt)
+	d.Set("updated_at", domain.UpdatedAt)
+
+	return nil
+}
+
+func customizeDiffDomain(d *schema.ResourceDiff, meta interface{}) error {
+	if !d.Get("authoritative").(bool) || !d.NewValueKnown("managed_records") {
+		return nil
+	}
+
+	// The records are shown as drift and removed during the update
+	o, _ := d.GetChange("unmanaged_records")
+	managed := managedRecordKeys(d.Get("managed_records").(*schema.Set))
+
+	for _, record := range o.(map[string]interface{}) {
+		key := strings.SplitN(record.(string), " ", 2)[0]
+		if !managed[key] {
+			return d.SetNew("unmanaged_records", map[string]interface{}{})
+		}
+	}
 
 	return nil
 }
+
+// setDomainAutoRenew enables, or disables, the automatic renewal of the domain registration
+func setDomainAutoRenew(meta interface{}, name string, enabled bool) error {
+	method := "DELETE"
+	if enabled {
+		method = "POST"
+	}
+
+	return dnsRequest(meta, method, fmt.Sprintf("/v1/domains/%s/auto_renewal", name))
+}
+
+// validateRecordKey validates that the given field is a <name>/<record type> string
+func validateRecordKey(i interface{}, k string) (s []string, es []error) {
+	value, ok := i.(string)
+	if !ok {
+		es = append(es, fmt.Errorf("expected type of %s to be string", k))
+		return
+	}
+
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 || parts[0] == "" {
+		es = append(es, fmt.Errorf("expected %s to be <name>/<record type>, e.g. www/A or @/MX, got %q", k, value))
+		return
+	}
+
+	for _, recordType := range domainRecordTypes {
+		if parts[1] == recordType {
+			return
+		}
+	}
+
+	es = append(es, fmt.Errorf("expected %s to have one of the record types %s, got %q", k, strings.Join(domainRecordTypes, ", "), parts[1]))
+	return
+}
+
+// isDefaultRecord tells whether the record is one of the NS or SOA entries of the domain itself
+//
+// The NS records of a subdomain are delegations, hence regular records.
+func isDefaultRecord(record egoscale.DNSRecord) bool {
+	return record.Name == "" && (record.RecordType == "NS" || record.RecordType == "SOA")
+}
+
+// recordKey identifies the records sharing a name and a type, e.g. www/A or @/MX
+func recordKey(name, recordType string) string {
+	if name == "" {
+		name = "@"
+	}
+
+	return fmt.Sprintf("%s/%s", name, strings.ToUpper(recordType))
+}
+
+// managedRecordKey identifies the records sharing a name, whatever its case, and a type
+func managedRecordKey(name, recordType string) string {
+	return recordKey(strings.ToLower(name), recordType)
+}
+
+// managedRecordKeys returns the keys of the managed_records
+//
+// Like the zone files, the domain only tells who owns the records of a name
+// and a type, the stray values are left to their owner, e.g. an
+// exoscale_domain_record_set.
+func managedRecordKeys(managed *schema.Set) map[string]bool {
+	keys := make(map[string]bool, managed.Len())
+	for _, value := range managed.List() {
+		parts := strings.Split(value.(string), "/")
+		if len(parts) == 2 {
+			keys[managedRecordKey(parts[0], parts[1])] = true
+		}
+	}
+
+	return keys
+}
@@ -1,14 +1,23 @@
 package exoscale
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
 
 	"github.com/exoscale/egoscale"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/helper/validation"
 )
 
+var domainRecordTypes = []string{
+	"A", "AAAA", "ALIAS", "CNAME", "HINFO", "MX", "NAPTR",
+	"NS", "POOL", "SPF", "SRV", "SSHFP", "TXT", "URL",
+}
+
 func domainRecordResource() *schema.Resource {
 	return &schema.Resource{
 		Create: createRecord,
@@ -18,9 +27,11 @@ func domainRecordResource() *schema.Resource {
 		Delete: deleteRecord,
 
 		Importer: &schema.ResourceImporter{
-			State: schema.ImportStatePassthrough,
+			State: importRecord,
 		},
 
+		CustomizeDiff: customizeDiffRecord,
+
 		Schema: map[string]*schema.Schema{
 			"domain": {
 				Type:     schema.TypeString,
@@ -31,16 +42,14 @@ func domainRecordResource() *schema.Resource {
 				Required: true,
 			},
 			"record_type": {
-				Type:     schema.TypeString,
-				Required: true,
-				ValidateFunc: validation.StringInSlice([]string{
-					"A", "AAAA", "ALIAS", "CNAME", "HINFO", "MX", "NAPTR",
-					"NS", "POOL", "SPF", "SRV", "SSHFP", "TXT", "URL",
-				}, true),
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.StringInSlice(domainRecordTypes, true),
 			},
 			"content": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:             schema.TypeString,
+				Required:         true,
+				DiffSuppressFunc: suppressRecordContentDiff,
 			},
 			"ttl": {
 				Type:     schema.TypeInt,
@@ -75,6 +84,8 @@ func createRecord(d *schema.ResourceData, meta interface{}) error {
 		return err
 	}
 
+	getRecordCache(meta).Add(record.ID, d.Get("domain").(string))
+
 	d.SetId(strconv.FormatInt(record.ID, 10))
 	return readRecord(d, meta)
 }
@@ -85,35 +96,27 @@ func existsRecord(d *schema.ResourceData, meta interface{}) (bool, error) {
 	id, _ := strconv.ParseInt(d.Id(), 10, 64)
 	domain := d.Get("domain").(string)
 
-	if domain != "" {
-		record, err := client.GetRecord(domain, id)
+	if domain == "" {
+		var err error
+		domain, err = getRecordCache(meta).Domain(client, id)
 		if err != nil {
-			if _, ok := err.(*egoscale.DNSErrorResponse); !ok {
-				return false, err
-			}
+			return false, err
 		}
-		return record != nil, nil
-	}
 
-	domains, err := client.GetDomains()
-	if err != nil {
-		return false, err
-	}
-
-	for _, domain := range domains {
-		record, err := client.GetRecord(domain.Name, id)
-		if err != nil {
-			if _, ok := err.(*egoscale.DNSErrorResponse); !ok {
-				return false, err
-			}
+		if domain == "" {
+			return false, nil
 		}
+	}
 
-		if record != nil {
-			return true, nil
+	_, err := client.GetRecord(domain, id)
+	if err != nil {
+		if isNotFoundError(err) {
+			return false, nil
 		}
+		return false, err
 	}
 
-	return false, nil
+	return true, nil
 }
 
 func readRecord(d *schema.ResourceData, meta interface{}) error {
@@ -122,33 +125,27 @@ func readRecord(d *schema.ResourceData, meta interface{}) error {
 	id, _ := strconv.ParseInt(d.Id(), 10, 64)
 	domain := d.Get("domain").(string)
 
-	if domain != "" {
-		record, err := client.GetRecord(domain, id)
+	if domain == "" {
+		var err error
+		domain, err = getRecordCache(meta).Domain(client, id)
 		if err != nil {
 			return err
 		}
 
-		return applyRecord(d, *record)
-	}
+		if domain == "" {
+			d.SetId("")
+			return nil
+		}
 
-	domains, err := client.GetDomains()
-	if err != nil {
-		return err
+		d.Set("domain", domain)
 	}
 
-	for _, domain := range domains {
-		record, err := client.GetRecord(domain.Name, id)
-		if err != nil {
-			return err
-		}
-
-		if record != nil {
-			d.Set("domain", domain.Name)
-			return applyRecord(d, *record)
-		}
+	record, err := client.GetRecord(domain, id)
+	if err != nil {
+		return handleNotFound(d, err)
 	}
 
-	return fmt.Errorf("domain record %s not found", d.Id())
+	return applyRecord(d, *record)
 }
 
 func updateRecord(d *schema.ResourceData, meta interface{}) error {
@@ -175,12 +172,97 @@ func deleteRecord(d *schema.ResourceData, meta interface{}) error {
 	client := GetDNSClient(meta)
 
 	id, _ := strconv.ParseInt(d.Id(), 10, 64)
-	err := client.DeleteRecord(d.Get("domain").(string), id)
+	if err := client.DeleteRecord(d.Get("domain").(string), id); err != nil && !isNotFoundError(err) {
+		return err
+	}
+
+	getRecordCache(meta).Remove(id)
+
+	d.SetId("")
+	return nil
+}
+
+func importRecord(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	// The content, e.g. of an URL record, may contain slashes
+	parts := strings.SplitN(d.Id(), "/", 4)
+
+	switch len(parts) {
+	case 1:
+		// by id
+	case 2:
+		if parts[0] == "" {
+			return nil, fmt.Errorf("import requires a domain, got %q", d.Id())
+		}
+
+		if _, err := strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return nil, fmt.Errorf("import requires <domain>/<record id> or <domain>/<name>/<record type>[/<content>], got %q", d.Id())
+		}
+
+		d.Set("domain", parts[0])
+		d.SetId(parts[1])
+	default:
+		if parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("import requires <domain>/<name>/<record type>[/<content>] (use @ for the domain itself), got %q", d.Id())
+		}
+
+		content := ""
+		if len(parts) == 4 {
+			content = parts[3]
+		}
+
+		record, err := findRecord(GetDNSClient(meta), parts[0], parts[1], parts[2], content)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Set("domain", parts[0])
+		d.SetId(strconv.FormatInt(record.ID, 10))
+	}
+
+	resources := make([]*schema.ResourceData, 1)
+	resources[0] = d
+	return resources, nil
+}
+
+// findRecord returns the single record matching the name, @ being the domain itself, the type and the content if any
+func findRecord(client *egoscale.Client, domain, name, recordType, content string) (*egoscale.DNSRecord, error) {
+	if name == "@" {
+		name = ""
+	}
+
+	records, err := getRecordSet(client, domain, name, recordType)
 	if err != nil {
-		d.SetId("")
+		return nil, err
 	}
 
-	return err
+	candidates := make([]egoscale.DNSRecord, 0, len(records))
+	for _, record := range records {
+		if content == "" || canonicalRecordContent(recordType, record.Content) == canonicalRecordContent(recordType, content) {
+			candidates = append(candidates, record)
+		}
+	}
+
+	key := recordKey(name, recordType)
+	if content != "" {
+		key = fmt.Sprintf("%s/%s", key, content)
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("no records found for %s in %s", key, domain)
+	case 1:
+		return &candidates[0], nil
+	}
+
+	lines := make([]string, len(candidates))
+	for i, record := range candidates {
+		lines[i] = fmt.Sprintf("  %s/%d: %s", domain, record.ID, record.Content)
+		if record.Prio != 0 {
+			lines[i] = fmt.Sprintf("%s (prio %d)", lines[i], record.Prio)
+		}
+	}
+
+	return nil, fmt.Errorf("%d records found for %s in %s, import one of them by id:\n%s", len(candidates), key, domain, strings.Join(lines, "\n"))
 }
 
 func applyRecord(d *schema.ResourceData, record egoscale.DNSRecord) error {
@@ -200,3 +282,256 @@ func applyRecord(d *schema.ResourceData, record egoscale.DNSRecord) error {
 
 	return nil
 }
+
+func customizeDiffRecord(d *schema.ResourceDiff, meta interface{}) error {
+	for _, key := range []string{"name", "record_type", "content", "prio"} {
+		if !d.NewValueKnown(key) {
+			return nil
+		}
+	}
+
+	return validateRecordContent(
+		d.Get("name").(string),
+		d.Get("record_type").(string),
+		d.Get("content").(string),
+		d.Get("prio").(int),
+	)
+}
+
+// validateRecordContent checks the content, and priority, against the record type
+func validateRecordContent(name, recordType, content string, prio int) error {
+	recordType = strings.ToUpper(recordType)
+
+	var es []error
+	switch recordType {
+	case "A":
+		_, es = ValidateIPv4String(content, "content")
+	case "AAAA":
+		_, es = ValidateIPv6String(content, "content")
+	case "CNAME":
+		if name == "" {
+			return fmt.Errorf("a CNAME record cannot be set on the domain itself, use an ALIAS record instead")
+		}
+		es = validateRecordHostname(content)
+	case "ALIAS", "NS", "POOL":
+		es = validateRecordHostname(content)
+	case "MX":
+		if err := validateRecordUint16("prio", prio); err != nil {
+			return err
+		}
+		es = validateRecordHostname(content)
+	case "SRV":
+		if err := validateRecordUint16("prio", prio); err != nil {
+			return err
+		}
+		labels := strings.SplitN(name, ".", 3)
+		if len(labels) < 2 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+			return fmt.Errorf("expected the name of a SRV record to be _<service>._<protocol>, got %q", name)
+		}
+		fields := strings.Fields(content)
+		if len(fields) != 3 {
+			return fmt.Errorf("expected the content of a SRV record to be <weight> <port> <target>, got %q", content)
+		}
+		for i, field := range []string{"weight", "port"} {
+			value, err := strconv.Atoi(fields[i])
+			if err != nil {
+				return fmt.Errorf("expected the SRV %s to be a number, got %q", field, fields[i])
+			}
+			if err := validateRecordUint16(field, value); err != nil {
+				return err
+			}
+		}
+		es = validateRecordHostname(fields[2])
+	case "SSHFP":
+		es = validateRecordSSHFP(content)
+	case "NAPTR":
+		es = validateRecordNAPTR(content)
+	case "TXT", "SPF":
+		es = validateRecordText(content)
+	}
+
+	if len(es) > 0 {
+		return fmt.Errorf("invalid %s record: %s", recordType, es[0])
+	}
+
+	return nil
+}
+
+// validateRecordUint16 checks the value fits in the 16 bits fields of the DNS records
+func validateRecordUint16(field string, value int) error {
+	if value < 0 || value > 65535 {
+		return fmt.Errorf("expected %s to be in the range (0 - 65535), got %d", field, value)
+	}
+
+	return nil
+}
+
+// validateRecordHostname checks the target is a domain name, with or without the trailing dot
+func validateRecordHostname(value string) (es []error) {
+	name := strings.TrimSuffix(value, ".")
+	if name == "" || len(name) > 253 {
+		es = append(es, fmt.Errorf("expected a domain name, got %q", value))
+		return
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			es = append(es, fmt.Errorf("expected a domain name, got %q", value))
+			return
+		}
+
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				es = append(es, fmt.Errorf("expected a domain name, got %q", value))
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// validateRecordSSHFP checks the content is <algorithm> <fingerprint type> <fingerprint>
+func validateRecordSSHFP(value string) (es []error) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 {
+		es = append(es, fmt.Errorf("expected <algorithm> <fingerprint type> <fingerprint>, got %q", value))
+		return
+	}
+
+	algorithm, err := strconv.Atoi(fields[0])
+	if err != nil || algorithm < 1 || algorithm > 6 || algorithm == 5 {
+		es = append(es, fmt.Errorf("expected the algorithm to be 1 (RSA), 2 (DSA), 3 (ECDSA), 4 (Ed25519) or 6 (Ed448), got %q", fields[0]))
+		return
+	}
+
+	lengths := map[string]int{"1": 40, "2": 64}
+	length, ok := lengths[fields[1]]
+	if !ok {
+		es = append(es, fmt.Errorf("expected the fingerprint type to be 1 (SHA-1) or 2 (SHA-256), got %q", fields[1]))
+		return
+	}
+
+	if _, err := hex.DecodeString(fields[2]); err != nil || len(fields[2]) != length {
+		es = append(es, fmt.Errorf("expected the fingerprint to be %d hexadecimal characters, got %q", length, fields[2]))
+	}
+
+	return
+}
+
+// validateRecordNAPTR checks the content is <order> <preference> "<flags>" "<service>" "<regexp>" <replacement>
+func validateRecordNAPTR(value string) (es []error) {
+	fields, err := recordContentFields(value)
+	if err != nil || len(fields) != 6 {
+		es = append(es, fmt.Errorf(`expected <order> <preference> "<flags>" "<service>" "<regexp>" <replacement>, got %q`, value))
+		return
+	}
+
+	for i, field := range []string{"order", "preference"} {
+		number, err := strconv.Atoi(fields[i])
+		if err != nil {
+			es = append(es, fmt.Errorf("expected the %s to be a number, got %q", field, fields[i]))
+			return
+		}
+		if err := validateRecordUint16(field, number); err != nil {
+			es = append(es, err)
+			return
+		}
+	}
+
+	for i, field := range []string{"flags", "service", "regexp"} {
+		if !strings.HasPrefix(fields[i+2], `"`) {
+			es = append(es, fmt.Errorf("expected the %s to be quoted, got %s", field, fields[i+2]))
+			return
+		}
+	}
+
+	if fields[5] != "." {
+		es = validateRecordHostname(fields[5])
+	}
+
+	return
+}
+
+// validateRecordText checks the quotes of the character strings are balanced
+func validateRecordText(value string) (es []error) {
+	if !strings.HasPrefix(value, `"`) {
+		return
+	}
+
+	fields, err := recordContentFields(value)
+	if err != nil {
+		es = append(es, err)
+		return
+	}
+
+	for _, field := range fields {
+		if !strings.HasPrefix(field, `"`) {
+			es = append(es, fmt.Errorf("expected only quoted strings, got %s", field))
+			return
+		}
+		if len(unquoteZoneFileString(field)) > 255 {
+			es = append(es, fmt.Errorf("expected quoted strings of at most 255 characters"))
+			return
+		}
+	}
+
+	return
+}
+
+// recordContentFields splits the content the way a zone file would
+func recordContentFields(value string) ([]string, error) {
+	if strings.Contains(value, "\n") {
+		return nil, fmt.Errorf("unexpected new line in %q", value)
+	}
+
+	entries, err := tokenizeZoneFile(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("expected a single line, got %q", value)
+	}
+
+	return entries[0].tokens, nil
+}
+
+// canonicalRecordContent returns a form of the content to compare records with,
+// it's never sent to the DNS API
+//
+// The targets are lowercased without their trailing dot, the IPv6 addresses
+// are compressed and the quotes of a TXT record made of strings are removed.
+func canonicalRecordContent(recordType, content string) string {
+	switch strings.ToUpper(recordType) {
+	case "AAAA":
+		if ip := net.ParseIP(content); ip != nil {
+			return ip.String()
+		}
+	case "CNAME", "ALIAS", "NS", "POOL", "MX":
+		return strings.ToLower(strings.TrimSuffix(content, "."))
+	case "SRV":
+		fields := strings.Fields(content)
+		if len(fields) == 3 {
+			fields[2] = strings.ToLower(strings.TrimSuffix(fields[2], "."))
+			return strings.Join(fields, " ")
+		}
+	case "TXT", "SPF":
+		if len(validateRecordText(content)) == 0 && strings.HasPrefix(content, `"`) {
+			fields, _ := recordContentFields(content)
+			var buf bytes.Buffer
+			for _, field := range fields {
+				buf.WriteString(unquoteZoneFileString(field))
+			}
+			return buf.String()
+		}
+	}
+
+	return content
+}
+
+// suppressRecordContentDiff ignores the differences the DNS API normalizes away
+func suppressRecordContentDiff(k, old, new string, d *schema.ResourceData) bool {
+	recordType := d.Get("record_type").(string)
+	return canonicalRecordContent(recordType, old) == canonicalRecordContent(recordType, new)
+}
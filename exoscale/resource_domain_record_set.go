@@ -0,0 +1,387 @@
+package exoscale
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/exoscale/egoscale"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+)
+
+func domainRecordSetResource() *schema.Resource {
+	return &schema.Resource{
+		Create: createRecordSet,
+		Read:   readRecordSet,
+		Exists: existsRecordSet,
+		Update: updateRecordSet,
+		Delete: deleteRecordSet,
+
+		Importer: &schema.ResourceImporter{
+			State: importRecordSet,
+		},
+
+		Schema: map[string]*schema.Schema{
+			"domain": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"record_type": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringInSlice(domainRecordTypes, true),
+				StateFunc: func(v interface{}) string {
+					return strings.ToUpper(v.(string))
+				},
+			},
+			"ttl": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				Computed: true,
+			},
+			"record": {
+				Type:     schema.TypeSet,
+				Required: true,
+				MinItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"content": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"prio": {
+							Type:     schema.TypeInt,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"hostname": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func createRecordSet(d *schema.ResourceData, meta interface{}) error {
+	// The records created before a failure belong to the set, hence it's
+	// kept in the state with the keys needed to read it back
+	d.SetId(recordSetID(
+		d.Get("domain").(string),
+		d.Get("name").(string),
+		d.Get("record_type").(string),
+	))
+
+	d.Partial(true)
+	d.SetPartial("domain")
+	d.SetPartial("name")
+	d.SetPartial("record_type")
+
+	if err := convergeRecordSet(d, meta); err != nil {
+		return err
+	}
+
+	d.Partial(false)
+
+	return readRecordSet(d, meta)
+}
+
+func existsRecordSet(d *schema.ResourceData, meta interface{}) (bool, error) {
+	client := GetDNSClient(meta)
+
+	records, err := getRecordSet(client, d.Get("domain").(string), d.Get("name").(string), d.Get("record_type").(string))
+	if err != nil {
+		if isNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return len(records) > 0, nil
+}
+
+func readRecordSet(d *schema.ResourceData, meta interface{}) error {
+	client := GetDNSClient(meta)
+
+	domain := d.Get("domain").(string)
+	records, err := getRecordSet(client, domain, d.Get("name").(string), d.Get("record_type").(string))
+	if err != nil {
+		return handleNotFound(d, err)
+	}
+
+	if len(records) == 0 {
+		d.SetId("")
+		return nil
+	}
+
+	return applyRecordSet(d, domain, records)
+}
+
+func updateRecordSet(d *schema.ResourceData, meta interface{}) error {
+	d.Partial(true)
+
+	if err := convergeRecordSet(d, meta); err != nil {
+		return err
+	}
+
+	d.Partial(false)
+
+	return readRecordSet(d, meta)
+}
+
+func deleteRecordSet(d *schema.ResourceData, meta interface{}) error {
+	client := GetDNSClient(meta)
+
+	domain := d.Get("domain").(string)
+	records, err := getRecordSet(client, domain, d.Get("name").(string), d.Get("record_type").(string))
+	if err != nil {
+		return handleNotFound(d, err)
+	}
+
+	for _, record := range records {
+		if err := client.DeleteRecord(domain, record.ID); err != nil && !isNotFoundError(err) {
+			return err
+		}
+	}
+
+	d.SetId("")
+	return nil
+}
+
+func importRecordSet(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	importID := d.Id()
+	parts := strings.Split(importID, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("import requires <domain>/<name>/<record type> (use @ for the domain itself), got %q", d.Id())
+	}
+
+	name := parts[1]
+	if name == "@" {
+		name = ""
+	}
+
+	d.Set("domain", parts[0])
+	d.Set("name", name)
+	d.Set("record_type", strings.ToUpper(parts[2]))
+
+	if err := readRecordSet(d, meta); err != nil {
+		return nil, err
+	}
+
+	if d.Id() == "" {
+		return nil, fmt.Errorf("no records found for %q", importID)
+	}
+
+	resources := make([]*schema.ResourceData, 1)
+	resources[0] = d
+	return resources, nil
+}
+
+// convergeRecordSet creates, updates and deletes the records so that they match the configuration.
+func convergeRecordSet(d *schema.ResourceData, meta interface{}) error {
+	client := GetDNSClient(meta)
+
+	domain := d.Get("domain").(string)
+	name := d.Get("name").(string)
+	recordType := strings.ToUpper(d.Get("record_type").(string))
+
+	// Without a ttl, the mixed ones read as -1 are kept
+	ttl := d.Get("ttl").(int)
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	current, err := getRecordSet(client, domain, name, recordType)
+	if err != nil {
+		return err
+	}
+
+	wanted := make([]egoscale.DNSRecord, 0)
+	for _, r := range d.Get("record").(*schema.Set).List() {
+		value := r.(map[string]interface{})
+		wanted = append(wanted, egoscale.DNSRecord{
+			Name:       name,
+			RecordType: recordType,
+			Content:    value["content"].(string),
+			Prio:       value["prio"].(int),
+			TTL:        ttl,
+		})
+	}
+
+	return convergeRecords(client, domain, current, wanted)
+}
+
+// convergeRecords turns the current records of the domain into the wanted ones.
+//
+// The records whose content and priority are already there are kept, the other
+// ones are reused for the missing values of the same name and type, before
+// creating or deleting the rest. A wanted TTL of zero keeps the current one.
+func convergeRecords(client *egoscale.Client, domain string, current, wanted []egoscale.DNSRecord) error {
+	missing := make([]egoscale.DNSRecord, len(wanted))
+	copy(missing, wanted)
+
+	stale := make([]egoscale.DNSRecord, 0, len(current))
+	for _, record := range current {
+		found := -1
+		for i, value := range missing {
+			if sameRecord(record, value) {
+				found = i
+				break
+			}
+		}
+
+		if found < 0 {
+			stale = append(stale, record)
+			continue
+		}
+		ttl := missing[found].TTL
+		missing = append(missing[:found], missing[found+1:]...)
+
+		if ttl != 0 && record.TTL != ttl {
+			if _, err := client.UpdateRecord(domain, egoscale.UpdateDNSRecord{
+				ID:         record.ID,
+				Name:       record.Name,
+				Content:    record.Content,
+				RecordType: record.RecordType,
+				TTL:        ttl,
+				Prio:       record.Prio,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, value := range missing {
+		reused := false
+		for i, record := range stale {
+			if !strings.EqualFold(record.Name, value.Name) || !strings.EqualFold(record.RecordType, value.RecordType) {
+				continue
+			}
+
+			if _, err := client.UpdateRecord(domain, egoscale.UpdateDNSRecord{
+				ID:         record.ID,
+				Name:       value.Name,
+				Content:    value.Content,
+				RecordType: value.RecordType,
+				TTL:        value.TTL,
+				Prio:       value.Prio,
+			}); err != nil {
+				return err
+			}
+
+			stale = append(stale[:i], stale[i+1:]...)
+			reused = true
+			break
+		}
+
+		if reused {
+			continue
+		}
+
+		if _, err := client.CreateRecord(domain, value); err != nil {
+			return err
+		}
+	}
+
+	for _, record := range stale {
+		if err := client.DeleteRecord(domain, record.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sameRecord tells whether both records share the name, type, content and priority
+//
+// The names are case insensitive and the contents are compared in their canonical form.
+func sameRecord(a, b egoscale.DNSRecord) bool {
+	return strings.EqualFold(a.Name, b.Name) &&
+		strings.EqualFold(a.RecordType, b.RecordType) &&
+		canonicalRecordContent(a.RecordType, a.Content) == canonicalRecordContent(b.RecordType, b.Content) &&
+		a.Prio == b.Prio
+}
+
+// getRecordSet returns the records of the domain having exactly the given name and type
+func getRecordSet(client *egoscale.Client, domain, name, recordType string) ([]egoscale.DNSRecord, error) {
+	records, err := client.GetRecordsWithFilters(domain, name, strings.ToUpper(recordType))
+	if err != nil {
+		return nil, err
+	}
+
+	// An empty name is not a filter, hence all the records are returned
+	set := make([]egoscale.DNSRecord, 0, len(records))
+	for _, record := range records {
+		if strings.EqualFold(record.Name, name) && strings.EqualFold(record.RecordType, recordType) {
+			set = append(set, record)
+		}
+	}
+
+	return set, nil
+}
+
+// recordSetID builds the identifier of a record set, the domain itself being @
+func recordSetID(domain, name, recordType string) string {
+	return fmt.Sprintf("%s/%s", domain, recordKey(name, recordType))
+}
+
+func applyRecordSet(d *schema.ResourceData, domain string, records []egoscale.DNSRecord) error {
+	// The name and the contents are kept as written when they only differ by their form
+	name := records[0].Name
+	if strings.EqualFold(d.Get("name").(string), name) {
+		name = d.Get("name").(string)
+	}
+	recordType := records[0].RecordType
+
+	d.SetId(recordSetID(domain, name, recordType))
+	d.Set("domain", domain)
+	d.Set("name", name)
+	d.Set("record_type", recordType)
+
+	// Records not sharing the same TTL show up as a diff of the configured one
+	ttl := records[0].TTL
+	for _, record := range records[1:] {
+		if record.TTL != ttl {
+			ttl = -1
+			break
+		}
+	}
+	d.Set("ttl", ttl)
+
+	written := d.Get("record").(*schema.Set).List()
+	values := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		content := record.Content
+		for _, w := range written {
+			value := w.(map[string]interface{})
+			if value["prio"].(int) == record.Prio && canonicalRecordContent(recordType, value["content"].(string)) == canonicalRecordContent(recordType, content) {
+				content = value["content"].(string)
+				break
+			}
+		}
+
+		values[i] = map[string]interface{}{
+			"content": content,
+			"prio":    record.Prio,
+		}
+	}
+	if err := d.Set("record", values); err != nil {
+		return err
+	}
+
+	if name == "" {
+		d.Set("hostname", domain)
+	} else {
+		d.Set("hostname", fmt.Sprintf("%s.%s", name, domain))
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package exoscale
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/exoscale/egoscale"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestApplyRecordSetTTL(t *testing.T) {
+	records := []egoscale.DNSRecord{
+		{Name: "www", RecordType: "A", Content: "1.2.3.4", TTL: 300},
+		{Name: "www", RecordType: "A", Content: "1.2.3.5", TTL: 300},
+	}
+
+	d := domainRecordSetResource().TestResourceData()
+	if err := applyRecordSet(d, "example.com", records); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := d.Get("ttl").(int); ttl != 300 {
+		t.Errorf("expected the shared ttl, got %d", ttl)
+	}
+
+	records[1].TTL = 3600
+	if err := applyRecordSet(d, "example.com", records); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := d.Get("ttl").(int); ttl != -1 {
+		t.Errorf("expected the mixed ttl to be -1, got %d", ttl)
+	}
+}
+
+func TestSameRecord(t *testing.T) {
+	tests := []struct {
+		a, b egoscale.DNSRecord
+		same bool
+	}{
+		{egoscale.DNSRecord{Name: "", RecordType: "MX", Content: "mail.example.com", Prio: 10}, egoscale.DNSRecord{Name: "", RecordType: "mx", Content: "Mail.Example.com.", Prio: 10}, true},
+		{egoscale.DNSRecord{Name: "www", RecordType: "A", Content: "1.2.3.4"}, egoscale.DNSRecord{Name: "WWW", RecordType: "A", Content: "1.2.3.4"}, true},
+		{egoscale.DNSRecord{Name: "", RecordType: "TXT", Content: "v=spf1 mx -all"}, egoscale.DNSRecord{Name: "", RecordType: "TXT", Content: `"v=spf1 mx -all"`}, true},
+		{egoscale.DNSRecord{Name: "", RecordType: "MX", Content: "mail.example.com", Prio: 10}, egoscale.DNSRecord{Name: "", RecordType: "MX", Content: "mail.example.com", Prio: 20}, false},
+		{egoscale.DNSRecord{Name: "www", RecordType: "A", Content: "1.2.3.4"}, egoscale.DNSRecord{Name: "www", RecordType: "A", Content: "1.2.3.5"}, false},
+	}
+
+	for _, test := range tests {
+		if same := sameRecord(test.a, test.b); same != test.same {
+			t.Errorf("%v and %v: expected %t, got %t", test.a, test.b, test.same, same)
+		}
+	}
+}
+
+func TestApplyRecordSetContent(t *testing.T) {
+	d := domainRecordSetResource().TestResourceData()
+	d.Set("name", "WWW")
+	d.Set("record", []map[string]interface{}{{"content": "Target.Example.com.", "prio": 0}})
+
+	records := []egoscale.DNSRecord{{Name: "www", RecordType: "CNAME", Content: "target.example.com"}}
+	if err := applyRecordSet(d, "example.com", records); err != nil {
+		t.Fatal(err)
+	}
+
+	if name := d.Get("name").(string); name != "WWW" {
+		t.Errorf("expected the name as written, got %s", name)
+	}
+
+	values := d.Get("record").(*schema.Set).List()
+	if len(values) != 1 || values[0].(map[string]interface{})["content"] != "Target.Example.com." {
+		t.Errorf("expected the content as written, got %v", values)
+	}
+}
+
+func TestAccDomainRecordSet(t *testing.T) {
+	domain := new(egoscale.DNSDomain)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckDNSRecordSetDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccDNSRecordSetCreate,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDNSDomainExists("exoscale_domain.exo", domain),
+					testAccCheckDNSRecordSetExists(domain, "www", "A", 2),
+				),
+			},
+			{
+				Config: testAccDNSRecordSetUpdate,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDNSDomainExists("exoscale_domain.exo", domain),
+					testAccCheckDNSRecordSetExists(domain, "www", "A", 3),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckDNSRecordSetExists(domain *egoscale.DNSDomain, name, recordType string, count int) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		client := GetDNSClient(testAccProvider.Meta())
+
+		records, err := getRecordSet(client, domain.Name, name, recordType)
+		if err != nil {
+			return err
+		}
+
+		if len(records) != count {
+			return fmt.Errorf("DNS Record Set: expected %d records, got %d", count, len(records))
+		}
+
+		for _, record := range records {
+			if record.TTL != 300 {
+				return fmt.Errorf("DNS Record Set: bad ttl, want 300, got %d", record.TTL)
+			}
+		}
+
+		return nil
+	}
+}
+
+func testAccCheckDNSRecordSetDestroy(s *terraform.State) error {
+	client := GetDNSClient(testAccProvider.Meta())
+
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "exoscale_domain_record_set" {
+			continue
+		}
+
+		records, err := getRecordSet(client, rs.Primary.Attributes["domain"], rs.Primary.Attributes["name"], rs.Primary.Attributes["record_type"])
+		if err != nil {
+			if _, ok := err.(*egoscale.DNSErrorResponse); ok {
+				return nil
+			}
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		return fmt.Errorf("DNS Record Set: still exists")
+	}
+	return nil
+}
+
+var testAccDNSRecordSetCreate = `
+resource "exoscale_domain" "exo" {
+  name = "acceptance.exo"
+}
+
+resource "exoscale_domain_record_set" "www" {
+  domain = "${exoscale_domain.exo.id}"
+  name = "www"
+  record_type = "A"
+  ttl = 300
+
+  record {
+    content = "1.2.3.4"
+  }
+
+  record {
+    content = "1.2.3.5"
+  }
+}
+`
+
+var testAccDNSRecordSetUpdate = `
+resource "exoscale_domain" "exo" {
+  name = "acceptance.exo"
+}
+
+resource "exoscale_domain_record_set" "www" {
+  domain = "${exoscale_domain.exo.id}"
+  name = "www"
+  record_type = "A"
+  ttl = 300
+
+  record {
+    content = "1.2.3.5"
+  }
+
+  record {
+    content = "1.2.3.6"
+  }
+
+  record {
+    content = "1.2.3.7"
+  }
+}
+`
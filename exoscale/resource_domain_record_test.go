@@ -1,9 +1,14 @@
 package exoscale
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/exoscale/egoscale"
 	"github.com/hashicorp/terraform/helper/resource"
@@ -28,6 +33,22 @@ func TestAccDomainRecord(t *testing.T) {
 					testAccCheckDNSRecordCreateAttributes("www", "1.2.3.4"),
 				),
 			},
+			resource.TestStep{
+				ResourceName:      "exoscale_domain_record.www",
+				ImportState:       true,
+				ImportStateVerify: true,
+				ImportStateIdFunc: func(s *terraform.State) (string, error) {
+					return fmt.Sprintf("%s/%d", domain.Name, record.ID), nil
+				},
+			},
+			resource.TestStep{
+				ResourceName:      "exoscale_domain_record.www",
+				ImportState:       true,
+				ImportStateVerify: true,
+				ImportStateIdFunc: func(s *terraform.State) (string, error) {
+					return fmt.Sprintf("%s/www/A/1.2.3.4", domain.Name), nil
+				},
+			},
 		},
 	})
 }
@@ -125,3 +146,124 @@ resource "exoscale_domain_record" "www" {
   content = "1.2.3.4"
 }
 `
+
+func TestValidateRecordContent(t *testing.T) {
+	type record struct {
+		name       string
+		recordType string
+		content    string
+		prio       int
+	}
+
+	valid := []record{
+		{"www", "A", "1.2.3.4", 0},
+		{"www", "AAAA", "2001:db8::1", 0},
+		{"www", "CNAME", "example.net.", 0},
+		{"", "ALIAS", "example.net", 0},
+		{"", "MX", "mail.example.com.", 10},
+		{"_sip._tcp", "SRV", "60 5060 sip.example.com", 10},
+		{"www", "SSHFP", "4 2 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", 0},
+		{"www", "SSHFP", "1 1 0123456789abcdef0123456789abcdef01234567", 0},
+		{"", "NAPTR", `100 10 "u" "E2U+sip" "!^.*$!sip:info@example.com!" .`, 0},
+		{"", "TXT", "v=spf1 -all", 0},
+		{"", "TXT", `"v=DKIM1; k=rsa;" "p=abcd"`, 0},
+		{"www", "URL", "https://example.com", 0},
+	}
+
+	for _, r := range valid {
+		if err := validateRecordContent(r.name, r.recordType, r.content, r.prio); err != nil {
+			t.Errorf("%s %s %q: %s", r.name, r.recordType, r.content, err)
+		}
+	}
+
+	invalid := []record{
+		{"www", "A", "2001:db8::1", 0},
+		{"www", "A", "example.com", 0},
+		{"www", "AAAA", "1.2.3.4", 0},
+		{"", "CNAME", "example.net", 0},
+		{"www", "CNAME", "1.2.3.4 example.net", 0},
+		{"", "MX", "mail.example.com", 70000},
+		{"", "MX", "-mail.example.com", 10},
+		{"sip", "SRV", "60 5060 sip.example.com", 10},
+		{"_sip._tcp", "SRV", "60 sip.example.com", 10},
+		{"_sip._tcp", "SRV", "60 99999 sip.example.com", 10},
+		{"www", "SSHFP", "5 2 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", 0},
+		{"www", "SSHFP", "4 1 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", 0},
+		{"www", "SSHFP", "4 2 xyz", 0},
+		{"", "NAPTR", `100 10 u "E2U+sip" "!^.*$!sip:info@example.com!" .`, 0},
+		{"", "NAPTR", `100 10 "u" "E2U+sip" .`, 0},
+		{"", "TXT", `"v=spf1 -all`, 0},
+		{"", "TXT", `"v=spf1" -all`, 0},
+	}
+
+	for _, r := range invalid {
+		if err := validateRecordContent(r.name, r.recordType, r.content, r.prio); err == nil {
+			t.Errorf("%s %s %q: an error was expected", r.name, r.recordType, r.content)
+		}
+	}
+}
+
+func TestCanonicalRecordContent(t *testing.T) {
+	values := []struct {
+		recordType string
+		content    string
+		expected   string
+	}{
+		{"A", "1.2.3.4", "1.2.3.4"},
+		{"AAAA", "2001:0db8:0000::0001", "2001:db8::1"},
+		{"CNAME", "WWW.Example.NET.", "www.example.net"},
+		{"MX", "mail.example.com.", "mail.example.com"},
+		{"SRV", "60 5060 SIP.example.com.", "60 5060 sip.example.com"},
+		{"TXT", `"v=DKIM1; k=rsa;" "p=abcd"`, "v=DKIM1; k=rsa;p=abcd"},
+		{"TXT", `say "hello"`, `say "hello"`},
+		{"URL", "https://Example.com/", "https://Example.com/"},
+	}
+
+	for _, v := range values {
+		if content := canonicalRecordContent(v.recordType, v.content); content != v.expected {
+			t.Errorf("%s %q: expected %q, got %q", v.recordType, v.content, v.expected, content)
+		}
+	}
+}
+
+func TestCreateRecordContent(t *testing.T) {
+	// a DKIM key longer than 255 characters, split into strings
+	content := fmt.Sprintf(`"v=DKIM1; k=rsa; p=%s" "%s"`, strings.Repeat("A", 200), strings.Repeat("B", 200))
+
+	sent := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			var body egoscale.DNSRecordResponse
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Error(err)
+			}
+			sent = body.Record.Content
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(egoscale.DNSRecordResponse{ // nolint: errcheck
+			Record: egoscale.DNSRecord{ID: 1, Name: "mail._domainkey", RecordType: "TXT", Content: sent},
+		})
+	}))
+	defer ts.Close()
+
+	meta := &BaseConfig{
+		credentials: &credentials{key: "EXO", secret: "secret"},
+		dns:         endpointConfig{endpoint: ts.URL, timeout: time.Minute},
+		recordCache: newRecordCache(),
+	}
+
+	d := domainRecordResource().TestResourceData()
+	d.Set("domain", "example.com")
+	d.Set("name", "mail._domainkey")
+	d.Set("record_type", "TXT")
+	d.Set("content", content)
+
+	if err := createRecord(d, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent != content {
+		t.Errorf("expected the content to be sent as written, got %s", sent)
+	}
+}
@@ -2,10 +2,14 @@ package exoscale
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/exoscale/egoscale"
 	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 )
 
@@ -77,6 +81,10 @@ func testAccCheckDNSDomainCreateAttributes(name string) resource.TestCheckFunc {
 				return fmt.Errorf("DNS Domain: expected token to be set")
 			}
 
+			if rs.Primary.Attributes["created_at"] == "" {
+				return fmt.Errorf("DNS Domain: expected created_at to be set")
+			}
+
 			return nil
 		}
 
@@ -112,3 +120,101 @@ resource "exoscale_domain" "exo" {
   name = "acceptance.exo"
 }
 `
+
+func TestRecordKey(t *testing.T) {
+	if k := recordKey("", "mx"); k != "@/MX" {
+		t.Errorf("bad key for the domain itself, got %s", k)
+	}
+	if k := recordKey("www", "A"); k != "www/A" {
+		t.Errorf("bad key, got %s", k)
+	}
+}
+
+func TestValidateRecordKey(t *testing.T) {
+	for _, key := range []string{"www/A", "@/MX", "_sip._tcp/SRV"} {
+		if _, errs := validateRecordKey(key, "test_property"); len(errs) != 0 {
+			t.Errorf("no errors were expected for %s", key)
+		}
+	}
+
+	for _, key := range []string{"www", "www/a", "/A", "www/A/1.2.3.4", "www/SOA"} {
+		if _, errs := validateRecordKey(key, "test_property"); len(errs) == 0 {
+			t.Errorf("an error was expected for %s", key)
+		}
+	}
+}
+
+func TestManagedRecordKeys(t *testing.T) {
+	managed := schema.NewSet(schema.HashString, []interface{}{"@/MX", "WWW/AAAA"})
+	keys := managedRecordKeys(managed)
+
+	if !keys[managedRecordKey("", "MX")] {
+		t.Errorf("expected the MX records of the domain to be managed, got %v", keys)
+	}
+	if !keys[managedRecordKey("www", "AAAA")] {
+		t.Errorf("expected the AAAA records to be managed, got %v", keys)
+	}
+	if keys[managedRecordKey("www", "A")] {
+		t.Errorf("expected the A records to be unmanaged, got %v", keys)
+	}
+}
+
+func TestIsDefaultRecord(t *testing.T) {
+	tests := []struct {
+		record egoscale.DNSRecord
+		result bool
+	}{
+		{egoscale.DNSRecord{Name: "", RecordType: "NS"}, true},
+		{egoscale.DNSRecord{Name: "", RecordType: "SOA"}, true},
+		{egoscale.DNSRecord{Name: "sub", RecordType: "NS"}, false},
+		{egoscale.DNSRecord{Name: "", RecordType: "MX"}, false},
+	}
+
+	for _, test := range tests {
+		if result := isDefaultRecord(test.record); result != test.result {
+			t.Errorf("%s/%s: expected %t, got %t", test.record.Name, test.record.RecordType, test.result, result)
+		}
+	}
+}
+
+func TestExistsDomain(t *testing.T) {
+	tests := []struct {
+		status int
+		exists bool
+		err    bool
+	}{
+		{http.StatusOK, true, false},
+		{http.StatusNotFound, false, false},
+		{http.StatusUnauthorized, false, true},
+		{http.StatusInternalServerError, false, true},
+	}
+
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(test.status)
+			if test.status == http.StatusOK {
+				fmt.Fprint(w, `{"domain": {"name": "example.com"}}`) // nolint: errcheck
+			} else {
+				fmt.Fprint(w, `{"message": "failure"}`) // nolint: errcheck
+			}
+		}))
+
+		meta := &BaseConfig{
+			credentials: &credentials{key: "EXO", secret: "secret"},
+			dns:         endpointConfig{endpoint: ts.URL, timeout: time.Minute},
+		}
+
+		for name, exists := range map[string]schema.ExistsFunc{"exoscale_domain": existsDomain, "exoscale_domain_zonefile": existsZoneFile} {
+			d := domainResource().TestResourceData()
+			d.SetId("example.com")
+
+			ok, err := exists(d, meta)
+			if ok != test.exists || (err != nil) != test.err {
+				t.Errorf("%s %d: expected %t and an error %t, got %t and %v", name, test.status, test.exists, test.err, ok, err)
+			}
+		}
+
+		ts.Close()
+	}
+}
@@ -0,0 +1,241 @@
+package exoscale
+
+import (
+	"github.com/exoscale/egoscale"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func domainZoneFileResource() *schema.Resource {
+	return &schema.Resource{
+		Create: createZoneFile,
+		Read:   readZoneFile,
+		Exists: existsZoneFile,
+		Update: updateZoneFile,
+		Delete: deleteZoneFile,
+
+		Importer: &schema.ResourceImporter{
+			State: importZoneFile,
+		},
+
+		CustomizeDiff: customizeDiffZoneFile,
+
+		Schema: map[string]*schema.Schema{
+			"domain": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"content": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "RFC 1035 master file, owning the records of the names and types it lists",
+			},
+		},
+	}
+}
+
+func createZoneFile(d *schema.ResourceData, meta interface{}) error {
+	if err := convergeZoneFile(d, meta); err != nil {
+		return err
+	}
+
+	d.SetId(d.Get("domain").(string))
+
+	return readZoneFile(d, meta)
+}
+
+func existsZoneFile(d *schema.ResourceData, meta interface{}) (bool, error) {
+	client := GetDNSClient(meta)
+
+	_, err := client.GetDomain(d.Id())
+	if err != nil {
+		if isNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func readZoneFile(d *schema.ResourceData, meta interface{}) error {
+	client := GetDNSClient(meta)
+
+	current, err := getZoneFileRecords(client, d.Id())
+	if err != nil {
+		return handleNotFound(d, err)
+	}
+
+	d.Set("domain", d.Id())
+
+	// An imported zone file takes every record, otherwise only the ones sharing
+	// a name and a type with the content are read, keeping it as written unless
+	// they have drifted
+	if content := d.Get("content").(string); content != "" {
+		wanted, err := parseZoneFile(d.Id(), content)
+		if err != nil {
+			return err
+		}
+
+		wanted = withoutDefaultRecords(wanted)
+		current = ownedRecords(current, wanted)
+		if sameZoneFileRecords(current, wanted) {
+			return nil
+		}
+	}
+
+	return d.Set("content", renderZoneFile(d.Id(), current))
+}
+
+func updateZoneFile(d *schema.ResourceData, meta interface{}) error {
+	if err := convergeZoneFile(d, meta); err != nil {
+		return err
+	}
+
+	return readZoneFile(d, meta)
+}
+
+func deleteZoneFile(d *schema.ResourceData, meta interface{}) error {
+	client := GetDNSClient(meta)
+
+	domain := d.Get("domain").(string)
+	wanted, err := parseZoneFile(domain, d.Get("content").(string))
+	if err != nil {
+		return err
+	}
+
+	current, err := getZoneFileRecords(client, domain)
+	if err != nil {
+		return handleNotFound(d, err)
+	}
+
+	// Only the records of the zone file are removed
+	for _, record := range current {
+		for _, value := range wanted {
+			if sameRecord(record, value) {
+				if err := client.DeleteRecord(domain, record.ID); err != nil && !isNotFoundError(err) {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	d.SetId("")
+	return nil
+}
+
+func importZoneFile(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	if err := readZoneFile(d, meta); err != nil {
+		return nil, err
+	}
+
+	resources := make([]*schema.ResourceData, 1)
+	resources[0] = d
+	return resources, nil
+}
+
+func customizeDiffZoneFile(d *schema.ResourceDiff, meta interface{}) error {
+	if !d.NewValueKnown("domain") || !d.NewValueKnown("content") {
+		return nil
+	}
+
+	_, err := parseZoneFile(d.Get("domain").(string), d.Get("content").(string))
+	return err
+}
+
+// convergeZoneFile makes the records of the domain match the zone file
+func convergeZoneFile(d *schema.ResourceData, meta interface{}) error {
+	client := GetDNSClient(meta)
+
+	domain := d.Get("domain").(string)
+	o, n := d.GetChange("content")
+	wanted, err := parseZoneFile(domain, n.(string))
+	if err != nil {
+		return err
+	}
+
+	// The records removed from the file are still owned by it
+	previous, err := parseZoneFile(domain, o.(string))
+	if err != nil {
+		return err
+	}
+
+	current, err := getZoneFileRecords(client, domain)
+	if err != nil {
+		return err
+	}
+
+	current = ownedRecords(current, append(previous, wanted...))
+	return convergeRecords(client, domain, current, withoutDefaultRecords(wanted))
+}
+
+// ownedRecords keeps the records sharing a name and a type with the zone file ones
+//
+// The other records of the domain, e.g. the exoscale_domain_record ones, are left alone.
+func ownedRecords(records, zoneFile []egoscale.DNSRecord) []egoscale.DNSRecord {
+	keys := make(map[string]bool, len(zoneFile))
+	for _, record := range zoneFile {
+		keys[managedRecordKey(record.Name, record.RecordType)] = true
+	}
+
+	owned := make([]egoscale.DNSRecord, 0, len(records))
+	for _, record := range records {
+		if keys[managedRecordKey(record.Name, record.RecordType)] {
+			owned = append(owned, record)
+		}
+	}
+
+	return owned
+}
+
+// getZoneFileRecords returns the records of the domain, except its own NS and SOA ones
+func getZoneFileRecords(client *egoscale.Client, domain string) ([]egoscale.DNSRecord, error) {
+	records, err := client.GetRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	return withoutDefaultRecords(records), nil
+}
+
+// withoutDefaultRecords filters out the NS and SOA entries of the domain itself
+func withoutDefaultRecords(records []egoscale.DNSRecord) []egoscale.DNSRecord {
+	filtered := make([]egoscale.DNSRecord, 0, len(records))
+	for _, record := range records {
+		if !isDefaultRecord(record) {
+			filtered = append(filtered, record)
+		}
+	}
+
+	return filtered
+}
+
+// sameZoneFileRecords tells whether the current records are exactly the wanted ones
+//
+// A wanted TTL of zero, meaning the default one, matches any TTL.
+func sameZoneFileRecords(current, wanted []egoscale.DNSRecord) bool {
+	if len(current) != len(wanted) {
+		return false
+	}
+
+	missing := make([]egoscale.DNSRecord, len(wanted))
+	copy(missing, wanted)
+
+	for _, record := range current {
+		found := -1
+		for i, value := range missing {
+			if sameRecord(record, value) && (value.TTL == 0 || value.TTL == record.TTL) {
+				found = i
+				break
+			}
+		}
+
+		if found < 0 {
+			return false
+		}
+		missing = append(missing[:found], missing[found+1:]...)
+	}
+
+	return true
+}
@@ -0,0 +1,138 @@
+package exoscale
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/exoscale/egoscale"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestAccDomainZoneFile(t *testing.T) {
+	domain := new(egoscale.DNSDomain)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckDNSZoneFileDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccDNSZoneFileCreate,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDNSDomainExists("exoscale_domain.exo", domain),
+					testAccCheckDNSZoneFileExists(domain, 3),
+				),
+			},
+			{
+				Config: testAccDNSZoneFileUpdate,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDNSDomainExists("exoscale_domain.exo", domain),
+					// the ftp record belongs to the exoscale_domain_record
+					testAccCheckDNSZoneFileExists(domain, 3),
+					resource.TestCheckResourceAttrSet("data.exoscale_domain_zonefile.exo", "content"),
+				),
+			},
+		},
+	})
+}
+
+func TestOwnedRecords(t *testing.T) {
+	records := []egoscale.DNSRecord{
+		{Name: "", RecordType: "MX", Content: "mail.example.com"},
+		{Name: "www", RecordType: "A", Content: "1.2.3.4"},
+		{Name: "www", RecordType: "AAAA", Content: "::1"},
+		{Name: "ftp", RecordType: "A", Content: "1.2.3.5"},
+	}
+	zoneFile := []egoscale.DNSRecord{
+		{Name: "", RecordType: "MX", Content: "mx.example.com"},
+		{Name: "www", RecordType: "A", Content: "1.2.3.6"},
+	}
+
+	owned := ownedRecords(records, zoneFile)
+	if len(owned) != 2 || owned[0].RecordType != "MX" || owned[1].Content != "1.2.3.4" {
+		t.Errorf("expected the @/MX and www/A records, got %v", owned)
+	}
+}
+
+func testAccCheckDNSZoneFileExists(domain *egoscale.DNSDomain, count int) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		client := GetDNSClient(testAccProvider.Meta())
+
+		records, err := getZoneFileRecords(client, domain.Name)
+		if err != nil {
+			return err
+		}
+
+		if len(records) != count {
+			return fmt.Errorf("DNS Zone File: expected %d records, got %d", count, len(records))
+		}
+
+		return nil
+	}
+}
+
+func testAccCheckDNSZoneFileDestroy(s *terraform.State) error {
+	client := GetDNSClient(testAccProvider.Meta())
+
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "exoscale_domain_zonefile" {
+			continue
+		}
+
+		records, err := getZoneFileRecords(client, rs.Primary.ID)
+		if err != nil {
+			if _, ok := err.(*egoscale.DNSErrorResponse); ok {
+				return nil
+			}
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		return fmt.Errorf("DNS Zone File: records still exist")
+	}
+	return nil
+}
+
+var testAccDNSZoneFileCreate = `
+resource "exoscale_domain" "exo" {
+  name = "acceptance.exo"
+}
+
+resource "exoscale_domain_zonefile" "exo" {
+  domain = "${exoscale_domain.exo.id}"
+  content = <<EOF
+$TTL 300
+@    IN MX 10 mail
+www  IN A  1.2.3.4
+mail IN A  1.2.3.5
+EOF
+}
+`
+
+var testAccDNSZoneFileUpdate = `
+resource "exoscale_domain" "exo" {
+  name = "acceptance.exo"
+}
+
+resource "exoscale_domain_zonefile" "exo" {
+  domain = "${exoscale_domain.exo.id}"
+  content = <<EOF
+$TTL 300
+www  IN A     1.2.3.6
+blog IN CNAME www
+EOF
+}
+
+resource "exoscale_domain_record" "ftp" {
+  domain = "${exoscale_domain.exo.id}"
+  name = "ftp"
+  record_type = "A"
+  content = "1.2.3.7"
+}
+
+data "exoscale_domain_zonefile" "exo" {
+  domain = "${exoscale_domain_zonefile.exo.id}"
+}
+`
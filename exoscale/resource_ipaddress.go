@@ -18,9 +18,10 @@ func elasticIPResource() *schema.Resource {
 		},
 		"zone": {
 			Type:        schema.TypeString,
-			Required:    true,
+			Optional:    true,
+			Computed:    true,
 			ForceNew:    true,
-			Description: "Name of the Data-Center",
+			Description: "Name of the Data-Center, the one of the provider by default",
 		},
 	}
 
@@ -54,9 +55,7 @@ func createElasticIP(d *schema.ResourceData, meta interface{}) error {
 
 	client := GetComputeClient(meta)
 
-	zoneName := d.Get("zone").(string)
-
-	zone, err := getZoneByName(ctx, client, zoneName)
+	zone, err := getZone(ctx, d, meta)
 	if err != nil {
 		return err
 	}
@@ -27,9 +27,11 @@ func networkResource() *schema.Resource {
 			Required: true,
 		},
 		"zone": {
-			Type:     schema.TypeString,
-			Required: true,
-			ForceNew: true,
+			Type:        schema.TypeString,
+			Optional:    true,
+			Computed:    true,
+			ForceNew:    true,
+			Description: "Name of the Data-Center, the one of the provider by default",
 		},
 		"cidr": {
 			Type:         schema.TypeString,
@@ -94,8 +96,7 @@ func createNetwork(d *schema.ResourceData, meta interface{}) error {
 		displayText = name
 	}
 
-	zoneName := d.Get("zone").(string)
-	zone, err := getZoneByName(ctx, client, zoneName)
+	zone, err := getZone(ctx, d, meta)
 	if err != nil {
 		return err
 	}
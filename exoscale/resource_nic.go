@@ -14,11 +14,15 @@ func nicResource() *schema.Resource {
 		Create: createNic,
 		Exists: existsNic,
 		Read:   readNic,
+		Update: updateNic,
 		Delete: deleteNic,
 
+		CustomizeDiff: customizeDiffNic,
+
 		Timeouts: &schema.ResourceTimeout{
 			Create: schema.DefaultTimeout(defaultTimeout),
 			Read:   schema.DefaultTimeout(defaultTimeout),
+			Update: schema.DefaultTimeout(defaultTimeout),
 			Delete: schema.DefaultTimeout(defaultTimeout),
 		},
 
@@ -36,10 +40,15 @@ func nicResource() *schema.Resource {
 			"ip_address": {
 				Type:         schema.TypeString,
 				Optional:     true,
-				ForceNew:     true,
-				Description:  "IP address",
+				Description:  "IP address, changed in place on a managed network",
 				ValidateFunc: ValidateIPv4String,
 			},
+			"default": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Make it the default NIC of the compute instance, changed in place",
+			},
 			"netmask": {
 				Type:     schema.TypeString,
 				Computed: true,
@@ -95,6 +104,13 @@ func createNic(d *schema.ResourceData, meta interface{}) error {
 	}
 
 	d.SetId(nic.ID.String())
+
+	if d.Get("default").(bool) {
+		if err := switchDefaultNic(ctx, client, vmID, nic.ID, true); err != nil {
+			return err
+		}
+	}
+
 	return readNic(d, meta)
 }
 
@@ -132,6 +148,77 @@ func readNic(d *schema.ResourceData, meta interface{}) error {
 	return applyNic(d, nic)
 }
 
+// customizeDiffNic recreates the NIC on an IP address change, unless its network is managed
+func customizeDiffNic(d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || !d.HasChange("ip_address") {
+		return nil
+	}
+
+	// A new network already recreates the NIC
+	if d.HasChange("network_id") || !d.NewValueKnown("network_id") {
+		return nil
+	}
+
+	if d.Get("ip_address").(string) == "" {
+		return d.ForceNew("ip_address")
+	}
+
+	networkID, err := egoscale.ParseUUID(d.Get("network_id").(string))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), meta.(*BaseConfig).compute.timeout)
+	defer cancel()
+
+	network := &egoscale.Network{ID: networkID}
+	if err := GetComputeClient(meta).GetWithContext(ctx, network); err != nil {
+		return err
+	}
+
+	// Only the managed networks lease the IP addresses
+	if network.CIDR == nil {
+		return d.ForceNew("ip_address")
+	}
+
+	return nil
+}
+
+func updateNic(d *schema.ResourceData, meta interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
+	client := GetComputeClient(meta)
+
+	id, err := egoscale.ParseUUID(d.Id())
+	if err != nil {
+		return err
+	}
+
+	if d.HasChange("ip_address") {
+		_, err := client.RequestWithContext(ctx, &egoscale.UpdateVMNicIP{
+			NicID:     id,
+			IPAddress: net.ParseIP(d.Get("ip_address").(string)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("default") {
+		vmID, err := egoscale.ParseUUID(d.Get("compute_id").(string))
+		if err != nil {
+			return err
+		}
+
+		if err := switchDefaultNic(ctx, client, vmID, id, d.Get("default").(bool)); err != nil {
+			return err
+		}
+	}
+
+	return readNic(d, meta)
+}
+
 func existsNic(d *schema.ResourceData, meta interface{}) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutRead))
 	defer cancel()
@@ -188,6 +275,13 @@ func deleteNic(d *schema.ResourceData, meta interface{}) error {
 		return err
 	}
 
+	// The default NIC cannot be removed
+	if d.Get("default").(bool) {
+		if err := switchDefaultNic(ctx, client, vmID, id, false); err != nil {
+			return err
+		}
+	}
+
 	resp, err := client.RequestWithContext(ctx, &egoscale.RemoveNicFromVirtualMachine{
 		NicID:            id,
 		VirtualMachineID: vmID,
@@ -207,8 +301,52 @@ func deleteNic(d *schema.ResourceData, meta interface{}) error {
 	return nil
 }
 
+// switchDefaultNic makes the NIC the default one or, if not, gives this role
+// back to another NIC of the instance, the public one first
+func switchDefaultNic(ctx context.Context, client *egoscale.Client, vmID, nicID *egoscale.UUID, isDefault bool) error {
+	vm := &egoscale.VirtualMachine{ID: vmID}
+	if err := client.GetWithContext(ctx, vm); err != nil {
+		return err
+	}
+
+	current := vm.DefaultNic()
+	target := nicID
+	if !isDefault {
+		if current == nil || !current.ID.Equal(*nicID) {
+			return nil
+		}
+
+		target = nil
+		for _, nic := range vm.Nic {
+			if nic.ID.Equal(*nicID) {
+				continue
+			}
+			if target == nil || nic.Type != "Isolated" {
+				target = nic.ID
+			}
+			if nic.Type != "Isolated" {
+				break
+			}
+		}
+
+		if target == nil {
+			return fmt.Errorf("VM %s has no other NIC to be the default one", vmID)
+		}
+	} else if current != nil && current.ID.Equal(*nicID) {
+		return nil
+	}
+
+	_, err := client.RequestWithContext(ctx, &egoscale.UpdateDefaultNicForVirtualMachine{
+		NicID:            target,
+		VirtualMachineID: vmID,
+	})
+
+	return err
+}
+
 func applyNic(d *schema.ResourceData, nic egoscale.Nic) error {
 	d.SetId(nic.ID.String())
+	d.Set("default", nic.IsDefault)
 	d.Set("compute_id", nic.VirtualMachineID.String())
 	d.Set("network_id", nic.NetworkID.String())
 	d.Set("mac_address", nic.MACAddress.String())
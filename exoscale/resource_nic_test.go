@@ -34,6 +34,78 @@ func TestAccNic(t *testing.T) {
 	})
 }
 
+func TestAccNicUpdateIP(t *testing.T) {
+	vm := new(egoscale.VirtualMachine)
+	nic := new(egoscale.Nic)
+	var id string
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckNicDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccNicManaged("10.0.0.10"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckNicExists("exoscale_nic.nic", vm, nic),
+					resource.TestCheckResourceAttr("exoscale_nic.nic", "ip_address", "10.0.0.10"),
+					func(s *terraform.State) error {
+						id = nic.ID.String()
+						return nil
+					},
+				),
+			},
+			{
+				Config: testAccNicManaged("10.0.0.11"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckNicExists("exoscale_nic.nic", vm, nic),
+					resource.TestCheckResourceAttr("exoscale_nic.nic", "ip_address", "10.0.0.11"),
+					func(s *terraform.State) error {
+						if nic.ID.String() != id {
+							return fmt.Errorf("the NIC was expected to be updated in place, got %s instead of %s", nic.ID, id)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccNicDefault(t *testing.T) {
+	vm := new(egoscale.VirtualMachine)
+	nic := new(egoscale.Nic)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckNicDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccNicDefault(true),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckNicExists("exoscale_nic.nic", vm, nic),
+					resource.TestCheckResourceAttr("exoscale_nic.nic", "default", "true"),
+				),
+			},
+			{
+				// the compute is refreshed after the switch
+				Config: testAccNicDefault(true),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("exoscale_compute.vm", "ip_address", "10.0.0.10"),
+				),
+			},
+			{
+				Config: testAccNicDefault(false),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckNicExists("exoscale_nic.nic", vm, nic),
+					resource.TestCheckResourceAttr("exoscale_nic.nic", "default", "false"),
+				),
+			},
+		},
+	})
+}
+
 func testAccCheckNicExists(n string, vm *egoscale.VirtualMachine, nic *egoscale.Nic) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
 		rs, ok := s.RootModule().Resources[n]
@@ -151,3 +223,78 @@ resource "exoscale_nic" "nic" {
 	EXOSCALE_ZONE,
 	EXOSCALE_NETWORK_OFFERING,
 )
+
+func testAccNicManaged(ip string) string {
+	return fmt.Sprintf(`
+resource "exoscale_ssh_keypair" "key" {
+  name = "terraform-test-keypair"
+}
+
+resource "exoscale_compute" "vm" {
+  display_name = "terraform-test-compute"
+  template = %q
+  zone = %q
+  size = "Micro"
+  disk_size = "12"
+  key_pair = "${exoscale_ssh_keypair.key.name}"
+}
+
+resource "exoscale_network" "net" {
+  name = "terraform-test-network"
+  display_text = "Terraform Acceptance Test"
+  zone = %q
+  network_offering = %q
+  cidr = "10.0.0.0/24"
+}
+
+resource "exoscale_nic" "nic" {
+  compute_id = "${exoscale_compute.vm.id}"
+  network_id = "${exoscale_network.net.id}"
+  ip_address = %q
+}
+`,
+		EXOSCALE_TEMPLATE,
+		EXOSCALE_ZONE,
+		EXOSCALE_ZONE,
+		EXOSCALE_NETWORK_OFFERING,
+		ip,
+	)
+}
+
+func testAccNicDefault(isDefault bool) string {
+	return fmt.Sprintf(`
+resource "exoscale_ssh_keypair" "key" {
+  name = "terraform-test-keypair"
+}
+
+resource "exoscale_compute" "vm" {
+  display_name = "terraform-test-compute"
+  template = %q
+  zone = %q
+  size = "Micro"
+  disk_size = "12"
+  key_pair = "${exoscale_ssh_keypair.key.name}"
+}
+
+resource "exoscale_network" "net" {
+  name = "terraform-test-network"
+  display_text = "Terraform Acceptance Test"
+  zone = %q
+  network_offering = %q
+  cidr = "10.0.0.0/24"
+}
+
+resource "exoscale_nic" "nic" {
+  compute_id = "${exoscale_compute.vm.id}"
+  network_id = "${exoscale_network.net.id}"
+  ip_address = "10.0.0.10"
+  default = %t
+}
+`,
+		EXOSCALE_TEMPLATE,
+		EXOSCALE_ZONE,
+		EXOSCALE_ZONE,
+		EXOSCALE_NETWORK_OFFERING,
+		isDefault,
+	)
+}
@@ -3,6 +3,8 @@ package exoscale
 import (
 	"context"
 	"fmt"
+	"log"
+	"strconv"
 	"strings"
 
 	"github.com/exoscale/egoscale"
@@ -21,6 +23,8 @@ func securityGroupRuleResource() *schema.Resource {
 			State: importSecurityGroupRule,
 		},
 
+		CustomizeDiff: customizeDiffSecurityGroupRule,
+
 		Timeouts: &schema.ResourceTimeout{
 			Create: schema.DefaultTimeout(defaultTimeout),
 			Read:   schema.DefaultTimeout(defaultTimeout),
@@ -54,18 +58,35 @@ func securityGroupRuleResource() *schema.Resource {
 				ForceNew: true,
 			},
 			"cidr": {
-				Type:          schema.TypeString,
-				Optional:      true,
-				ForceNew:      true,
-				ValidateFunc:  validation.CIDRNetwork(0, 128),
-				ConflictsWith: []string{"user_security_group"},
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				ValidateFunc:     ValidateCIDRNetwork,
+				DiffSuppressFunc: suppressCIDRDiff,
+				ConflictsWith:    []string{"user_security_group", "user_security_group_id"},
+			},
+			"ipv6_cidr": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				Description:      "IPv6 network of the companion rule created alongside the IPv4 one",
+				ValidateFunc:     ValidateIPv6CIDRNetwork,
+				DiffSuppressFunc: suppressCIDRDiff,
+				ConflictsWith:    []string{"user_security_group", "user_security_group_id"},
+			},
+			"ipv6_rule_id": {
+				Type:     schema.TypeString,
+				Computed: true,
 			},
 			"protocol": {
 				Type:         schema.TypeString,
 				Optional:     true,
 				Default:      "tcp",
 				ForceNew:     true,
-				ValidateFunc: validation.StringInSlice([]string{"TCP", "UDP", "ICMP", "ICMPv6", "AH", "ESP", "GRE", "ALL"}, true),
+				ValidateFunc: validation.StringInSlice(securityGroupRuleProtocols, true),
+				StateFunc: func(v interface{}) string {
+					return normalizeSecurityGroupRuleProtocol(v.(string))
+				},
 			},
 			"start_port": {
 				Type:          schema.TypeInt,
@@ -175,40 +196,59 @@ func createSecurityGroupRule(d *schema.ResourceData, meta interface{}) error {
 		})
 	}
 
-	var req egoscale.Command
-	req = &egoscale.AuthorizeSecurityGroupIngress{
+	protocol := normalizeSecurityGroupRuleProtocol(d.Get("protocol").(string))
+
+	req := &egoscale.AuthorizeSecurityGroupIngress{
 		SecurityGroupID:       securityGroup.ID,
 		CIDRList:              cidrList,
 		Description:           d.Get("description").(string),
-		Protocol:              d.Get("protocol").(string),
-		EndPort:               (uint16)(d.Get("end_port").(int)),
-		StartPort:             (uint16)(d.Get("start_port").(int)),
-		IcmpType:              (uint8)(d.Get("icmp_type").(int)),
-		IcmpCode:              (uint8)(d.Get("icmp_code").(int)),
+		Protocol:              strings.ToLower(protocol),
 		UserSecurityGroupList: groupList,
 	}
 
-	trafficType := strings.ToUpper(d.Get("type").(string))
-	if trafficType == "EGRESS" {
-		// yay! types
-		req = (*egoscale.AuthorizeSecurityGroupEgress)(req.(*egoscale.AuthorizeSecurityGroupIngress))
+	if isICMPProtocol(protocol) {
+		req.IcmpType = (uint8)(d.Get("icmp_type").(int))
+		req.IcmpCode = (uint8)(d.Get("icmp_code").(int))
+	} else {
+		req.StartPort = (uint16)(d.Get("start_port").(int))
+		req.EndPort = (uint16)(d.Get("end_port").(int))
 	}
 
-	resp, err := client.RequestWithContext(ctx, req)
+	trafficType := strings.ToUpper(d.Get("type").(string))
+	rule, err := authorizeSecurityGroupRule(ctx, client, trafficType, req)
 	if err != nil {
 		return err
 	}
 
-	// The rule allowed for creation produces only one rule!
 	d.Set("type", trafficType)
-	if trafficType == "EGRESS" {
-		sg := resp.(*egoscale.SecurityGroup)
-		d.Set("type", trafficType)
-		return applySecurityGroupRule(d, securityGroup, sg.EgressRule[0])
+	if err := applySecurityGroupRule(d, securityGroup, *rule); err != nil {
+		return err
 	}
 
-	sg := resp.(*egoscale.SecurityGroup)
-	return applySecurityGroupRule(d, securityGroup, (egoscale.EgressRule)(sg.IngressRule[0]))
+	// The IPv6 companion rule is a copy of the IPv4 one
+	if ipv6CIDR, ok := d.GetOk("ipv6_cidr"); ok {
+		c, err := egoscale.ParseCIDR(ipv6CIDR.(string))
+		if err != nil {
+			return err
+		}
+
+		req.CIDRList = []egoscale.CIDR{*c}
+		ipv6Rule, err := authorizeSecurityGroupRule(ctx, client, trafficType, req)
+		if err != nil {
+			// Attempting to remove the freshly created IPv4 rule
+			if e := revokeSecurityGroupRule(ctx, client, trafficType, rule.RuleID); e != nil {
+				log.Printf("[WARNING] Failure to create the IPv6 rule, but the IPv4 rule was created. %v", e)
+			}
+			d.SetId("")
+
+			return err
+		}
+
+		d.Set("ipv6_rule_id", ipv6Rule.RuleID.String())
+		d.Set("ipv6_cidr", ipv6Rule.CIDR.String())
+	}
+
+	return nil
 }
 
 func existsSecurityGroupRule(d *schema.ResourceData, meta interface{}) (bool, error) {
@@ -286,21 +326,28 @@ func readSecurityGroupRule(d *schema.ResourceData, meta interface{}) error {
 		return handleNotFound(d, err)
 	}
 
-	id := d.Id()
-	for _, rule := range sg.EgressRule {
-		if rule.RuleID.String() == id {
-			d.Set("type", "EGRESS")
-			return applySecurityGroupRule(d, sg, rule)
-		}
+	trafficType, rule := findSecurityGroupRule(sg, d.Id())
+	if rule == nil {
+		d.SetId("")
+		return nil
 	}
-	for _, rule := range sg.IngressRule {
-		if rule.RuleID.String() == id {
-			d.Set("type", "INGRESS")
-			return applySecurityGroupRule(d, sg, (egoscale.EgressRule)(rule))
+
+	d.Set("type", trafficType)
+	if err := applySecurityGroupRule(d, sg, *rule); err != nil {
+		return err
+	}
+
+	// A missing IPv6 companion rule forces the recreation of both
+	if ipv6RuleID := d.Get("ipv6_rule_id").(string); ipv6RuleID != "" {
+		_, ipv6Rule := findSecurityGroupRule(sg, ipv6RuleID)
+		if ipv6Rule == nil || ipv6Rule.CIDR == nil {
+			d.Set("ipv6_rule_id", "")
+			d.Set("ipv6_cidr", "")
+		} else {
+			d.Set("ipv6_cidr", ipv6Rule.CIDR.String())
 		}
 	}
 
-	d.SetId("")
 	return nil
 }
 
@@ -315,22 +362,97 @@ func deleteSecurityGroupRule(d *schema.ResourceData, meta interface{}) error {
 		return err
 	}
 
-	var req egoscale.Command
-	if d.Get("type").(string) == "EGRESS" {
-		req = &egoscale.RevokeSecurityGroupEgress{
-			ID: id,
+	trafficType := d.Get("type").(string)
+
+	if ipv6RuleID := d.Get("ipv6_rule_id").(string); ipv6RuleID != "" {
+		ipv6ID, err := egoscale.ParseUUID(ipv6RuleID)
+		if err != nil {
+			return err
 		}
-	} else {
-		req = &egoscale.RevokeSecurityGroupIngress{
-			ID: id,
+
+		if err := revokeSecurityGroupRule(ctx, client, trafficType, ipv6ID); err != nil {
+			return err
 		}
+		d.Set("ipv6_rule_id", "")
 	}
 
-	return client.BooleanRequestWithContext(ctx, req)
+	return revokeSecurityGroupRule(ctx, client, trafficType, id)
 }
 
 func importSecurityGroupRule(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
-	if err := readSecurityGroupRule(d, meta); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutRead))
+	defer cancel()
+
+	client := GetComputeClient(meta)
+
+	filter, err := parseSecurityGroupRuleImportID(d.Id())
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*egoscale.SecurityGroup, 0)
+	if filter.securityGroup == "" {
+		// Only the rule ID was given, it may belong to any of them
+		sgs, err := client.ListWithContext(ctx, &egoscale.SecurityGroup{})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sg := range sgs {
+			groups = append(groups, sg.(*egoscale.SecurityGroup))
+		}
+	} else {
+		sg := &egoscale.SecurityGroup{}
+
+		id, err := egoscale.ParseUUID(filter.securityGroup)
+		if err != nil {
+			sg.Name = filter.securityGroup
+		} else {
+			sg.ID = id
+		}
+
+		if err := client.GetWithContext(ctx, sg); err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, sg)
+	}
+
+	type ruleMatch struct {
+		securityGroup *egoscale.SecurityGroup
+		trafficType   string
+		rule          egoscale.EgressRule
+	}
+
+	matches := make([]ruleMatch, 0, 1)
+	for _, sg := range groups {
+		for _, rule := range sg.EgressRule {
+			if filter.match("EGRESS", rule) {
+				matches = append(matches, ruleMatch{sg, "EGRESS", rule})
+			}
+		}
+		for _, rule := range sg.IngressRule {
+			if filter.match("INGRESS", (egoscale.EgressRule)(rule)) {
+				matches = append(matches, ruleMatch{sg, "INGRESS", (egoscale.EgressRule)(rule)})
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("Security Group Rule not found: %s", d.Id())
+	}
+
+	if len(matches) > 1 {
+		ids := make([]string, len(matches))
+		for i, m := range matches {
+			ids[i] = m.rule.RuleID.String()
+		}
+		return nil, fmt.Errorf("More than one Security Group Rule matches %s: %s", d.Id(), strings.Join(ids, ", "))
+	}
+
+	m := matches[0]
+	d.Set("type", m.trafficType)
+	if err := applySecurityGroupRule(d, m.securityGroup, m.rule); err != nil {
 		return nil, err
 	}
 
@@ -349,12 +471,295 @@ func applySecurityGroupRule(d *schema.ResourceData, group *egoscale.SecurityGrou
 	d.Set("icmp_code", rule.IcmpCode)
 	d.Set("start_port", rule.StartPort)
 	d.Set("end_port", rule.EndPort)
-	d.Set("protocol", strings.ToUpper(rule.Protocol))
+	d.Set("protocol", normalizeSecurityGroupRuleProtocol(rule.Protocol))
+	d.Set("description", rule.Description)
 
 	d.Set("user_security_group", rule.SecurityGroupName)
 
-	d.Set("security_group_id", group.ID)
+	d.Set("security_group_id", group.ID.String())
 	d.Set("security_group", group.Name)
 
 	return nil
 }
+
+func customizeDiffSecurityGroupRule(d *schema.ResourceDiff, meta interface{}) error {
+	protocol := normalizeSecurityGroupRuleProtocol(d.Get("protocol").(string))
+
+	_, startPortOk := d.GetOk("start_port")
+	_, endPortOk := d.GetOk("end_port")
+	_, icmpTypeOk := d.GetOk("icmp_type")
+	_, icmpCodeOk := d.GetOk("icmp_code")
+
+	switch {
+	case isICMPProtocol(protocol):
+		if startPortOk || endPortOk {
+			return fmt.Errorf("start_port and end_port cannot be set on %s rules, use icmp_type and icmp_code", protocol)
+		}
+	case protocol == "TCP" || protocol == "UDP":
+		if icmpTypeOk || icmpCodeOk {
+			return fmt.Errorf("icmp_type and icmp_code cannot be set on %s rules, use start_port and end_port", protocol)
+		}
+	default:
+		if startPortOk || endPortOk || icmpTypeOk || icmpCodeOk {
+			return fmt.Errorf("neither ports nor ICMP type and code can be set on %s rules", protocol)
+		}
+	}
+
+	if !d.NewValueKnown("cidr") || !d.NewValueKnown("ipv6_cidr") {
+		return nil
+	}
+
+	cidr := d.Get("cidr").(string)
+	ipv6CIDR := d.Get("ipv6_cidr").(string)
+
+	if cidr != "" {
+		isIPv6 := strings.Contains(cidr, ":")
+		if protocol == "ICMP" && isIPv6 {
+			return fmt.Errorf("ICMP rules only apply to IPv4 networks, use ICMPv6 for %s", cidr)
+		}
+		if protocol == "ICMPv6" && !isIPv6 {
+			return fmt.Errorf("ICMPv6 rules only apply to IPv6 networks, use ICMP for %s", cidr)
+		}
+		if ipv6CIDR != "" && isIPv6 {
+			return fmt.Errorf("cidr must be an IPv4 network when ipv6_cidr is set, got %s", cidr)
+		}
+	}
+
+	if ipv6CIDR != "" {
+		if cidr == "" {
+			return fmt.Errorf("ipv6_cidr requires an IPv4 cidr to be set")
+		}
+		if isICMPProtocol(protocol) {
+			return fmt.Errorf("ipv6_cidr cannot be set on %s rules as ICMP and ICMPv6 types differ, define two rules instead", protocol)
+		}
+	}
+
+	return nil
+}
+
+// authorizeSecurityGroupRule creates an ingress or egress rule and returns it
+func authorizeSecurityGroupRule(ctx context.Context, client *egoscale.Client, trafficType string, req *egoscale.AuthorizeSecurityGroupIngress) (*egoscale.EgressRule, error) {
+	var cmd egoscale.Command = req
+	if trafficType == "EGRESS" {
+		// yay! types
+		cmd = (*egoscale.AuthorizeSecurityGroupEgress)(req)
+	}
+
+	resp, err := client.RequestWithContext(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// The rule allowed for creation produces only one rule!
+	sg := resp.(*egoscale.SecurityGroup)
+	if trafficType == "EGRESS" {
+		return &sg.EgressRule[0], nil
+	}
+
+	return (*egoscale.EgressRule)(&sg.IngressRule[0]), nil
+}
+
+// revokeSecurityGroupRule removes an ingress or egress rule
+func revokeSecurityGroupRule(ctx context.Context, client *egoscale.Client, trafficType string, id *egoscale.UUID) error {
+	var req egoscale.Command
+	if trafficType == "EGRESS" {
+		req = &egoscale.RevokeSecurityGroupEgress{
+			ID: id,
+		}
+	} else {
+		req = &egoscale.RevokeSecurityGroupIngress{
+			ID: id,
+		}
+	}
+
+	return client.BooleanRequestWithContext(ctx, req)
+}
+
+// findSecurityGroupRule returns the traffic type and the rule matching the ID
+func findSecurityGroupRule(sg *egoscale.SecurityGroup, id string) (string, *egoscale.EgressRule) {
+	for i, rule := range sg.EgressRule {
+		if rule.RuleID.String() == id {
+			return "EGRESS", &sg.EgressRule[i]
+		}
+	}
+	for i, rule := range sg.IngressRule {
+		if rule.RuleID.String() == id {
+			return "INGRESS", (*egoscale.EgressRule)(&sg.IngressRule[i])
+		}
+	}
+
+	return "", nil
+}
+
+var securityGroupRuleProtocols = []string{"TCP", "UDP", "ICMP", "ICMPv6", "AH", "ESP", "GRE", "ALL"}
+
+// normalizeSecurityGroupRuleProtocol returns the canonical spelling of the protocol, e.g. icmpv6 is ICMPv6
+func normalizeSecurityGroupRuleProtocol(protocol string) string {
+	for _, p := range securityGroupRuleProtocols {
+		if strings.EqualFold(p, protocol) {
+			return p
+		}
+	}
+
+	return strings.ToUpper(protocol)
+}
+
+// isICMPProtocol tells whether the rule uses ICMP type and code instead of ports
+func isICMPProtocol(protocol string) bool {
+	return strings.EqualFold(protocol, "ICMP") || strings.EqualFold(protocol, "ICMPv6")
+}
+
+// suppressCIDRDiff ignores the differences in notation of the same network, e.g. ::0/0 and ::/0
+func suppressCIDRDiff(k, old, new string, d *schema.ResourceData) bool {
+	o, err := egoscale.ParseCIDR(old)
+	if err != nil {
+		return false
+	}
+
+	n, err := egoscale.ParseCIDR(new)
+	if err != nil {
+		return false
+	}
+
+	return o.Equal(*n)
+}
+
+// securityGroupRuleFilter identifies a rule from an import ID, either by its
+// ID or by its attributes.
+type securityGroupRuleFilter struct {
+	securityGroup     string
+	ruleID            *egoscale.UUID
+	trafficType       string
+	protocol          string
+	startPort         uint16
+	endPort           uint16
+	icmpType          uint8
+	icmpCode          uint8
+	cidr              *egoscale.CIDR
+	userSecurityGroup string
+}
+
+// parseSecurityGroupRuleImportID reads any of the following import IDs
+//
+//	<rule-id>
+//	<security-group>/<rule-id>
+//	<security-group>/<type>/<protocol>/<ports>/<cidr or user-security-group>
+//
+// where the security group is given by name or ID, and the ports are either
+// empty, a single port, a range (8000-8080) or an ICMP type:code (8:0).
+func parseSecurityGroupRuleImportID(id string) (*securityGroupRuleFilter, error) {
+	filter := &securityGroupRuleFilter{}
+
+	parts := strings.SplitN(id, "/", 5)
+	switch len(parts) {
+	case 1:
+		ruleID, err := egoscale.ParseUUID(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("import requires a rule ID, got %q", id)
+		}
+		filter.ruleID = ruleID
+		return filter, nil
+	case 2:
+		ruleID, err := egoscale.ParseUUID(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("import requires <security-group>/<rule-id>, got %q", id)
+		}
+		filter.securityGroup = parts[0]
+		filter.ruleID = ruleID
+		return filter, nil
+	case 5:
+		// composite form, see below
+	default:
+		return nil, fmt.Errorf("import requires <security-group>/<type>/<protocol>/<ports>/<cidr>, got %q", id)
+	}
+
+	if parts[0] == "" {
+		return nil, fmt.Errorf("import requires a security group name or ID, got %q", id)
+	}
+	filter.securityGroup = parts[0]
+
+	filter.trafficType = strings.ToUpper(parts[1])
+	if filter.trafficType != "INGRESS" && filter.trafficType != "EGRESS" {
+		return nil, fmt.Errorf("type must be either INGRESS or EGRESS, got %q", parts[1])
+	}
+
+	filter.protocol = strings.ToLower(parts[2])
+	if filter.protocol == "" {
+		return nil, fmt.Errorf("protocol is missing from %q", id)
+	}
+
+	ports := parts[3]
+	if ports != "" {
+		if strings.HasPrefix(filter.protocol, "icmp") {
+			typeCode := strings.SplitN(ports, ":", 2)
+			icmpType, err := strconv.ParseUint(typeCode[0], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ICMP type %q: %s", typeCode[0], err)
+			}
+			filter.icmpType = uint8(icmpType)
+
+			if len(typeCode) == 2 {
+				icmpCode, err := strconv.ParseUint(typeCode[1], 10, 8)
+				if err != nil {
+					return nil, fmt.Errorf("invalid ICMP code %q: %s", typeCode[1], err)
+				}
+				filter.icmpCode = uint8(icmpCode)
+			}
+		} else {
+			portRange := strings.SplitN(ports, "-", 2)
+			startPort, err := strconv.ParseUint(portRange[0], 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port %q: %s", portRange[0], err)
+			}
+			filter.startPort = uint16(startPort)
+			filter.endPort = uint16(startPort)
+
+			if len(portRange) == 2 {
+				endPort, err := strconv.ParseUint(portRange[1], 10, 16)
+				if err != nil {
+					return nil, fmt.Errorf("invalid port %q: %s", portRange[1], err)
+				}
+				filter.endPort = uint16(endPort)
+			}
+		}
+	}
+
+	target := parts[4]
+	if target == "" {
+		return nil, fmt.Errorf("cidr or user security group is missing from %q", id)
+	}
+
+	cidr, err := egoscale.ParseCIDR(target)
+	if err != nil {
+		filter.userSecurityGroup = target
+	} else {
+		filter.cidr = cidr
+	}
+
+	return filter, nil
+}
+
+// match tells whether the given rule is the one described by the filter
+func (filter securityGroupRuleFilter) match(trafficType string, rule egoscale.EgressRule) bool {
+	if filter.ruleID != nil {
+		return rule.RuleID != nil && rule.RuleID.Equal(*filter.ruleID)
+	}
+
+	if filter.trafficType != trafficType || !strings.EqualFold(filter.protocol, rule.Protocol) {
+		return false
+	}
+
+	if rule.StartPort != filter.startPort || rule.EndPort != filter.endPort {
+		return false
+	}
+
+	if rule.IcmpType != filter.icmpType || rule.IcmpCode != filter.icmpCode {
+		return false
+	}
+
+	if filter.cidr != nil {
+		return rule.CIDR != nil && rule.CIDR.Equal(*filter.cidr)
+	}
+
+	return rule.CIDR == nil && rule.SecurityGroupName == filter.userSecurityGroup
+}
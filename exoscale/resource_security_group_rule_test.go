@@ -31,6 +31,11 @@ func TestAccSecurityGroupRule(t *testing.T) {
 					testAccCheckSecurityGroupRuleCreateAttributes("INGRESS", "ICMP"),
 				),
 			},
+			resource.TestStep{
+				ResourceName:      "exoscale_security_group_rule.cidr",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
 		},
 	})
 }
@@ -149,6 +154,7 @@ resource "exoscale_security_group_rule" "cidr" {
   cidr = "::/0"
   start_port = 2
   end_port = 1024
+  description = "Terraform Security Group Rule Test"
 }
 
 resource "exoscale_security_group_rule" "usg" {
@@ -160,3 +166,127 @@ resource "exoscale_security_group_rule" "usg" {
   user_security_group = "${exoscale_security_group.sg.name}"
 }
 `
+
+func TestParseSecurityGroupRuleImportID(t *testing.T) {
+	ruleID := "7e1e5a53-c0b2-4f37-8c5b-a6c5a0c2a1d4"
+
+	filter, err := parseSecurityGroupRuleImportID(ruleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.securityGroup != "" || filter.ruleID.String() != ruleID {
+		t.Errorf("bad filter for a bare rule ID, got %#v", filter)
+	}
+
+	filter, err = parseSecurityGroupRuleImportID("default/" + ruleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.securityGroup != "default" || filter.ruleID.String() != ruleID {
+		t.Errorf("bad filter for <sg>/<rule-id>, got %#v", filter)
+	}
+
+	filter, err = parseSecurityGroupRuleImportID("default/ingress/TCP/22/0.0.0.0/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.trafficType != "INGRESS" || filter.protocol != "tcp" {
+		t.Errorf("bad type or protocol, got %#v", filter)
+	}
+	if filter.startPort != 22 || filter.endPort != 22 {
+		t.Errorf("bad ports, got %d-%d", filter.startPort, filter.endPort)
+	}
+	if filter.cidr == nil || filter.cidr.String() != "0.0.0.0/0" {
+		t.Errorf("bad cidr, got %v", filter.cidr)
+	}
+
+	filter, err = parseSecurityGroupRuleImportID("default/EGRESS/udp/8000-8080/::/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.startPort != 8000 || filter.endPort != 8080 {
+		t.Errorf("bad ports, got %d-%d", filter.startPort, filter.endPort)
+	}
+	if filter.cidr == nil || filter.cidr.String() != "::/0" {
+		t.Errorf("bad cidr, got %v", filter.cidr)
+	}
+
+	filter, err = parseSecurityGroupRuleImportID("default/INGRESS/icmp/8:0/web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.icmpType != 8 || filter.icmpCode != 0 {
+		t.Errorf("bad icmp type/code, got %d:%d", filter.icmpType, filter.icmpCode)
+	}
+	if filter.cidr != nil || filter.userSecurityGroup != "web" {
+		t.Errorf("bad user security group, got %#v", filter)
+	}
+
+	for _, id := range []string{
+		"",
+		"default",
+		"default/hello",
+		"default/INGRESS/tcp/22",
+		"default/FORWARD/tcp/22/0.0.0.0/0",
+		"default/INGRESS/tcp/ssh/0.0.0.0/0",
+		"/INGRESS/tcp/22/0.0.0.0/0",
+	} {
+		if _, err := parseSecurityGroupRuleImportID(id); err == nil {
+			t.Errorf("an error was expected for %q", id)
+		}
+	}
+}
+
+func TestSecurityGroupRuleFilterMatch(t *testing.T) {
+	rule := egoscale.EgressRule{
+		RuleID:    egoscale.MustParseUUID("7e1e5a53-c0b2-4f37-8c5b-a6c5a0c2a1d4"),
+		CIDR:      egoscale.MustParseCIDR("0.0.0.0/0"),
+		Protocol:  "tcp",
+		StartPort: 22,
+		EndPort:   22,
+	}
+
+	filter, err := parseSecurityGroupRuleImportID("default/INGRESS/TCP/22/0.0.0.0/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !filter.match("INGRESS", rule) {
+		t.Error("the rule was expected to match")
+	}
+	if filter.match("EGRESS", rule) {
+		t.Error("the rule wasn't expected to match an egress rule")
+	}
+
+	rule.StartPort = 80
+	rule.EndPort = 80
+	if filter.match("INGRESS", rule) {
+		t.Error("the rule wasn't expected to match another port")
+	}
+}
+
+func TestNormalizeSecurityGroupRuleProtocol(t *testing.T) {
+	for protocol, expected := range map[string]string{
+		"tcp":    "TCP",
+		"ICMP":   "ICMP",
+		"icmpv6": "ICMPv6",
+		"ICMPV6": "ICMPv6",
+		"all":    "ALL",
+	} {
+		if p := normalizeSecurityGroupRuleProtocol(protocol); p != expected {
+			t.Errorf("bad protocol for %s, wanted %s, got %s", protocol, expected, p)
+		}
+	}
+}
+
+func TestSuppressCIDRDiff(t *testing.T) {
+	if !suppressCIDRDiff("cidr", "::/0", "::0/0", nil) {
+		t.Error("::/0 and ::0/0 are the same network")
+	}
+	if !suppressCIDRDiff("cidr", "2001:db8::/32", "2001:DB8::/32", nil) {
+		t.Error("the case of an IPv6 network doesn't matter")
+	}
+	if suppressCIDRDiff("cidr", "::/0", "0.0.0.0/0", nil) {
+		t.Error("::/0 and 0.0.0.0/0 are different networks")
+	}
+}
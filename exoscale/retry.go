@@ -0,0 +1,206 @@
+package exoscale
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/exoscale/egoscale"
+)
+
+const defaultMaxRetries = 3
+const defaultRetryBackoff = "fibonacci"
+
+// defaultRetryableHTTPStatuses are the HTTP statuses worth a second try
+var defaultRetryableHTTPStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// defaultRetryableCloudStackCodes are the CloudStack error and exception codes worth a second try
+var defaultRetryableCloudStackCodes = []int{
+	int(egoscale.InternalError),
+	int(egoscale.ConcurrentOperationException),
+	int(egoscale.AgentUnavailableException),
+}
+
+// unprocessedHTTPStatuses and unprocessedCloudStackCodes tell that the request
+// was rejected before doing anything, hence the non-idempotent requests can be
+// sent again
+var unprocessedHTTPStatuses = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusServiceUnavailable: true,
+}
+
+var unprocessedCloudStackCodes = map[int]bool{
+	int(egoscale.ConcurrentOperationException): true,
+}
+
+// retryConfig holds the retry settings of the provider
+type retryConfig struct {
+	maxRetries      int
+	backoff         egoscale.RetryStrategyFunc
+	httpStatuses    map[int]bool
+	cloudStackCodes map[int]bool
+}
+
+// newRetryConfig builds the settings, the backoff being either monotonic or fibonacci
+func newRetryConfig(maxRetries int, backoff string, httpStatuses, cloudStackCodes []int) retryConfig {
+	config := retryConfig{
+		maxRetries:      maxRetries,
+		backoff:         egoscale.FibonacciRetryStrategy,
+		httpStatuses:    make(map[int]bool, len(httpStatuses)),
+		cloudStackCodes: make(map[int]bool, len(cloudStackCodes)),
+	}
+
+	if backoff == "monotonic" {
+		config.backoff = egoscale.MonotonicRetryStrategyFunc(2)
+	}
+
+	for _, status := range httpStatuses {
+		config.httpStatuses[status] = true
+	}
+
+	for _, code := range cloudStackCodes {
+		config.cloudStackCodes[code] = true
+	}
+
+	return config
+}
+
+// retryTransport sends the requests again on transient errors
+//
+// The non-idempotent requests, e.g. deployVirtualMachine or the creation of a
+// DNS record, are only sent again when they surely weren't processed.
+type retryTransport struct {
+	transport http.RoundTripper
+	config    retryConfig
+}
+
+// RoundTrip executes a single HTTP transaction
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	idempotent := isIdempotentRequest(req)
+
+	r := req
+	for attempt := 1; ; attempt++ {
+		resp, err := t.transport.RoundTrip(r)
+		if attempt > t.config.maxRetries || !t.retryable(resp, err, idempotent) {
+			return resp, err
+		}
+
+		if err == nil {
+			log.Printf("[INFO] retrying %s %s after %s (%d/%d)", req.Method, req.URL.Path, resp.Status, attempt, t.config.maxRetries)
+			resp.Body.Close() // nolint: errcheck
+		} else {
+			log.Printf("[INFO] retrying %s %s after %s (%d/%d)", req.Method, req.URL.Path, err, attempt, t.config.maxRetries)
+		}
+
+		select {
+		case <-time.After(t.config.backoff(int64(attempt))):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		// The request of the caller isn't modified, a copy gets a fresh body
+		r = req.WithContext(req.Context())
+		if err := resetBody(r); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryable tells whether the request is worth sending again
+func (t *retryTransport) retryable(resp *http.Response, err error, idempotent bool) bool {
+	if err != nil {
+		// The connection wasn't even established
+		if e, ok := err.(*net.OpError); ok && e.Op == "dial" {
+			return true
+		}
+		return idempotent
+	}
+
+	if resp.StatusCode < 400 {
+		return false
+	}
+
+	if t.config.httpStatuses[resp.StatusCode] && (idempotent || unprocessedHTTPStatuses[resp.StatusCode]) {
+		return true
+	}
+
+	code, csCode := readErrorCodes(resp)
+	for _, code := range []int{code, csCode} {
+		if t.config.cloudStackCodes[code] && (idempotent || unprocessedCloudStackCodes[code]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readErrorCodes peeks at the CloudStack error codes of the response
+func readErrorCodes(resp *http.Response) (int, int) {
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close() // nolint: errcheck
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return 0, 0
+	}
+
+	var body map[string]struct {
+		ErrorCode   int `json:"errorcode"`
+		CSErrorCode int `json:"cserrorcode"`
+	}
+	if err := json.Unmarshal(b, &body); err != nil {
+		return 0, 0
+	}
+
+	for _, e := range body {
+		if e.ErrorCode != 0 {
+			return e.ErrorCode, e.CSErrorCode
+		}
+	}
+
+	return 0, 0
+}
+
+// isIdempotentRequest tells whether sending the request twice is harmless
+//
+// The DNS API follows the HTTP semantics, the compute API only has the
+// list, get and query commands without any side effects.
+func isIdempotentRequest(req *http.Request) bool {
+	if req.Header.Get("X-DNS-TOKEN") != "" {
+		return req.Method != "POST"
+	}
+
+	params := req.URL.Query()
+	if req.Method == "POST" && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return false
+		}
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			return false
+		}
+		if params, err = url.ParseQuery(string(b)); err != nil {
+			return false
+		}
+	}
+
+	command := strings.ToLower(params.Get("command"))
+	for _, prefix := range []string{"list", "get", "query"} {
+		if strings.HasPrefix(command, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
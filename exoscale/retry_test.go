@@ -0,0 +1,166 @@
+package exoscale
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRetryTransport(maxRetries int) *retryTransport {
+	config := newRetryConfig(maxRetries, "monotonic", defaultRetryableHTTPStatuses, defaultRetryableCloudStackCodes)
+	config.backoff = func(int64) time.Duration { return 0 }
+
+	return &retryTransport{
+		transport: http.DefaultTransport,
+		config:    config,
+	}
+}
+
+func TestIsIdempotentRequest(t *testing.T) {
+	tests := []struct {
+		method  string
+		command string
+		dns     bool
+		result  bool
+	}{
+		{"GET", "listVirtualMachines", false, true},
+		{"GET", "queryAsyncJobResult", false, true},
+		{"POST", "listZones", false, true},
+		{"GET", "deployVirtualMachine", false, false},
+		{"POST", "deployVirtualMachine", false, false},
+		{"GET", "", true, true},
+		{"PUT", "", true, true},
+		{"DELETE", "", true, true},
+		{"POST", "", true, false},
+	}
+
+	for _, test := range tests {
+		params := url.Values{}
+		params.Set("command", test.command)
+
+		var req *http.Request
+		var err error
+		if test.method == "POST" && !test.dns {
+			req, err = http.NewRequest("POST", "https://api.exoscale.ch/compute", strings.NewReader(params.Encode()))
+		} else {
+			req, err = http.NewRequest(test.method, "https://api.exoscale.ch/compute?"+params.Encode(), nil)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.dns {
+			req.Header.Set("X-DNS-TOKEN", "EXO:secret")
+		}
+
+		if result := isIdempotentRequest(req); result != test.result {
+			t.Errorf("%s %s (dns: %t): expected %t, got %t", test.method, test.command, test.dns, test.result, result)
+		}
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		command string
+		status  int
+		body    string
+		calls   int
+	}{
+		// idempotent calls are retried on any retryable error
+		{"listZones", http.StatusBadGateway, "", 4},
+		{"listZones", 530, `{"listzonesresponse": {"errorcode": 530, "cserrorcode": 4250}}`, 4},
+		{"listZones", http.StatusUnauthorized, "", 1},
+		{"listZones", 530, "", 1},
+		// non-idempotent ones only when they surely weren't processed
+		{"deployVirtualMachine", http.StatusBadGateway, "", 1},
+		{"deployVirtualMachine", 530, `{"deployvirtualmachineresponse": {"errorcode": 530, "cserrorcode": 4250}}`, 1},
+		{"deployVirtualMachine", http.StatusTooManyRequests, "", 4},
+		{"deployVirtualMachine", 530, `{"deployvirtualmachineresponse": {"errorcode": 530, "cserrorcode": 4300}}`, 4},
+	}
+
+	for _, test := range tests {
+		calls := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.body) // nolint: errcheck
+		}))
+
+		req, err := http.NewRequest("GET", ts.URL+"?command="+test.command, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := testRetryTransport(3).RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close() // nolint: errcheck
+		ts.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%s %d: expected the last status, got %d", test.command, test.status, resp.StatusCode)
+		}
+		if calls != test.calls {
+			t.Errorf("%s %d %s: expected %d calls, got %d", test.command, test.status, test.body, test.calls, calls)
+		}
+	}
+}
+
+func TestRetryTransportSucceeds(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("command") != "deployVirtualMachine" {
+			t.Errorf("the body wasn't sent again, got %v", r.PostForm)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	req, err := http.NewRequest("POST", ts.URL, strings.NewReader("command=deployVirtualMachine"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body := req.Body
+	resp, err := testRetryTransport(3).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close() // nolint: errcheck
+
+	if req.Body != body {
+		t.Error("the request of the caller was modified")
+	}
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Errorf("expected a success after 3 calls, got %d after %d", resp.StatusCode, calls)
+	}
+}
+
+func TestNewRetryConfig(t *testing.T) {
+	config := newRetryConfig(2, "fibonacci", []int{429}, []int{4300})
+	if config.backoff(4) != 3*time.Second {
+		t.Errorf("expected a fibonacci backoff, got %s", config.backoff(4))
+	}
+	if !config.httpStatuses[429] || config.httpStatuses[503] || config.httpStatuses[4300] {
+		t.Errorf("bad HTTP statuses, got %v", config.httpStatuses)
+	}
+	if !config.cloudStackCodes[4300] || config.cloudStackCodes[429] {
+		t.Errorf("bad CloudStack codes, got %v", config.cloudStackCodes)
+	}
+
+	config = newRetryConfig(2, "monotonic", nil, nil)
+	if config.backoff(1) != config.backoff(4) {
+		t.Errorf("expected a monotonic backoff, got %s and %s", config.backoff(1), config.backoff(4))
+	}
+}
@@ -3,9 +3,12 @@ package exoscale
 import (
 	"fmt"
 	"net"
+	"regexp"
 	"strings"
 )
 
+var hostnameLabel = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
 // ValidateIPv4String validates that the given field is a string representing an IPv4 address
 func ValidateIPv4String(i interface{}, k string) (s []string, es []error) {
 	value, ok := i.(string)
@@ -47,3 +50,53 @@ func ValidateIPv6String(i interface{}, k string) (s []string, es []error) {
 
 	return
 }
+
+// ValidateCIDRNetwork validates that the given field is a string representing an IPv4 or IPv6 network
+func ValidateCIDRNetwork(i interface{}, k string) (s []string, es []error) {
+	value, ok := i.(string)
+	if !ok {
+		es = append(es, fmt.Errorf("expected type of %s to be string", k))
+		return
+	}
+
+	ip, network, err := net.ParseCIDR(value)
+	if err != nil {
+		es = append(es, fmt.Errorf("expected %s to be a network in CIDR notation, got %q", k, value))
+		return
+	}
+
+	if !ip.Equal(network.IP) {
+		es = append(es, fmt.Errorf("expected %s to be a network address, got %s instead of %s", k, value, network))
+	}
+
+	return
+}
+
+// ValidateIPv6CIDRNetwork validates that the given field is a string representing an IPv6 network
+func ValidateIPv6CIDRNetwork(i interface{}, k string) (s []string, es []error) {
+	s, es = ValidateCIDRNetwork(i, k)
+	if len(es) > 0 {
+		return
+	}
+
+	if !strings.Contains(i.(string), ":") {
+		es = append(es, fmt.Errorf("expected %s to be an IPv6 network", k))
+	}
+
+	return
+}
+
+// ValidateHostnameString validates that the given field is a string representing a RFC 1123 hostname (a single label)
+func ValidateHostnameString(i interface{}, k string) (s []string, es []error) {
+	value, ok := i.(string)
+	if !ok {
+		es = append(es, fmt.Errorf("expected type of %s to be string", k))
+		return
+	}
+
+	if !hostnameLabel.MatchString(value) {
+		es = append(es, fmt.Errorf("expected %s to be a hostname of at most 63 letters, digits and hyphens, not starting nor ending with a hyphen, got %q", k, value))
+	}
+
+	return
+}
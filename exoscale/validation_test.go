@@ -1,6 +1,7 @@
 package exoscale
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -59,3 +60,61 @@ func TestValidateIPv6StringOk(t *testing.T) {
 		t.Error("no errors were expected")
 	}
 }
+
+func TestValidateCIDRNetworkNumber(t *testing.T) {
+	_, errs := ValidateCIDRNetwork(15, "test_property")
+	if len(errs) == 0 {
+		t.Error("an error was expected")
+	}
+}
+
+func TestValidateCIDRNetworkNonCIDR(t *testing.T) {
+	_, errs := ValidateCIDRNetwork("10.0.0.1", "test_property")
+	if len(errs) == 0 {
+		t.Error("an error was expected")
+	}
+}
+
+func TestValidateCIDRNetworkHostBits(t *testing.T) {
+	_, errs := ValidateCIDRNetwork("10.0.0.1/24", "test_property")
+	if len(errs) == 0 {
+		t.Error("an error was expected")
+	}
+}
+
+func TestValidateCIDRNetworkOk(t *testing.T) {
+	for _, cidr := range []string{"0.0.0.0/0", "10.0.0.0/24", "::/0", "::0/0", "2001:DB8::/32"} {
+		_, errs := ValidateCIDRNetwork(cidr, "test_property")
+		if len(errs) != 0 {
+			t.Errorf("no errors were expected for %s", cidr)
+		}
+	}
+}
+
+func TestValidateIPv6CIDRNetworkKo(t *testing.T) {
+	_, errs := ValidateIPv6CIDRNetwork("0.0.0.0/0", "test_property")
+	if len(errs) == 0 {
+		t.Error("an error was expected")
+	}
+}
+
+func TestValidateIPv6CIDRNetworkOk(t *testing.T) {
+	_, errs := ValidateIPv6CIDRNetwork("2001:db8::/32", "test_property")
+	if len(errs) != 0 {
+		t.Error("no errors were expected")
+	}
+}
+
+func TestValidateHostnameString(t *testing.T) {
+	for _, value := range []string{"a", "web-01", "1web", "WEB", strings.Repeat("a", 63)} {
+		if _, errs := ValidateHostnameString(value, "test_property"); len(errs) != 0 {
+			t.Errorf("%q: no errors were expected, got %v", value, errs)
+		}
+	}
+
+	for _, value := range []interface{}{15, "", "-web", "web-", "web_01", "web.example.com", "my web", strings.Repeat("a", 64)} {
+		if _, errs := ValidateHostnameString(value, "test_property"); len(errs) == 0 {
+			t.Errorf("%v: an error was expected", value)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package exoscale
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/exoscale/egoscale"
+)
+
+// zoneFileEntry is a logical line of a master file, parentheses being resolved
+type zoneFileEntry struct {
+	line int
+	// inherit tells that the line started with a blank, the previous owner is reused
+	inherit bool
+	tokens  []string
+}
+
+// tokenizeZoneFile splits the RFC 1035 master file into its entries
+func tokenizeZoneFile(content string) ([]zoneFileEntry, error) {
+	entries := make([]zoneFileEntry, 0)
+
+	var entry *zoneFileEntry
+	var token bytes.Buffer
+	hasToken := false
+	inQuote := false
+	inComment := false
+	depth := 0
+	line := 1
+	lineStart := true
+
+	flushToken := func() {
+		if hasToken {
+			entry.tokens = append(entry.tokens, token.String())
+		}
+		token.Reset()
+		hasToken = false
+	}
+
+	flushEntry := func() {
+		flushToken()
+		if entry != nil && len(entry.tokens) > 0 {
+			entries = append(entries, *entry)
+		}
+		entry = nil
+	}
+
+	runes := []rune(content)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		if lineStart && depth == 0 {
+			entry = &zoneFileEntry{
+				line:    line,
+				inherit: c == ' ' || c == '\t',
+			}
+		}
+		lineStart = false
+
+		if c == '\n' {
+			if inQuote {
+				return nil, fmt.Errorf("line %d: unterminated quoted string", line)
+			}
+			inComment = false
+			line++
+			lineStart = true
+			if depth > 0 {
+				flushToken()
+			} else {
+				flushEntry()
+			}
+			continue
+		}
+
+		if inComment {
+			continue
+		}
+
+		if inQuote {
+			token.WriteRune(c)
+			if c == '\\' && i+1 < len(runes) {
+				i++
+				token.WriteRune(runes[i])
+			} else if c == '"' {
+				inQuote = false
+			}
+			continue
+		}
+
+		switch {
+		case c == ';':
+			inComment = true
+			flushToken()
+		case c == '"':
+			inQuote = true
+			hasToken = true
+			token.WriteRune(c)
+		case c == '(':
+			depth++
+			flushToken()
+		case c == ')':
+			if depth == 0 {
+				return nil, fmt.Errorf("line %d: unbalanced parenthesis", line)
+			}
+			depth--
+			flushToken()
+		case unicode.IsSpace(c):
+			flushToken()
+		default:
+			hasToken = true
+			token.WriteRune(c)
+		}
+	}
+
+	if inQuote {
+		return nil, fmt.Errorf("line %d: unterminated quoted string", line)
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("line %d: unbalanced parenthesis", line)
+	}
+	flushEntry()
+
+	return entries, nil
+}
+
+// parseZoneFile reads the records of an RFC 1035 master file for the given domain
+//
+// The names are made relative to the domain, the targets are made absolute,
+// without the trailing dot, as the DNS API expects them. A record without any
+// TTL, nor $TTL directive, gets zero, the default of the API.
+func parseZoneFile(domain, content string) ([]egoscale.DNSRecord, error) {
+	entries, err := tokenizeZoneFile(content)
+	if err != nil {
+		return nil, err
+	}
+
+	zone := absoluteName(domain, ".")
+	origin := zone
+	defaultTTL := 0
+	owner := ""
+
+	records := make([]egoscale.DNSRecord, 0, len(entries))
+	for _, entry := range entries {
+		tokens := entry.tokens
+
+		switch strings.ToUpper(tokens[0]) {
+		case "$ORIGIN":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("line %d: $ORIGIN requires a single domain name", entry.line)
+			}
+			origin = absoluteName(tokens[1], origin)
+			continue
+		case "$TTL":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("line %d: $TTL requires a single value", entry.line)
+			}
+			ttl, err := parseZoneFileTTL(tokens[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", entry.line, err)
+			}
+			defaultTTL = ttl
+			continue
+		case "$INCLUDE", "$GENERATE":
+			return nil, fmt.Errorf("line %d: %s is not supported", entry.line, tokens[0])
+		}
+
+		if !entry.inherit {
+			owner = absoluteName(tokens[0], origin)
+			tokens = tokens[1:]
+		} else if owner == "" {
+			return nil, fmt.Errorf("line %d: no owner name to inherit", entry.line)
+		}
+
+		ttl := defaultTTL
+		for len(tokens) > 0 {
+			if strings.EqualFold(tokens[0], "IN") {
+				tokens = tokens[1:]
+				continue
+			}
+			if value, err := parseZoneFileTTL(tokens[0]); err == nil {
+				ttl = value
+				tokens = tokens[1:]
+				continue
+			}
+			break
+		}
+
+		if len(tokens) < 2 {
+			return nil, fmt.Errorf("line %d: a record requires a type and some data", entry.line)
+		}
+
+		name, err := relativeName(owner, zone)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", entry.line, err)
+		}
+
+		record := egoscale.DNSRecord{
+			Name:       name,
+			RecordType: strings.ToUpper(tokens[0]),
+			TTL:        ttl,
+		}
+
+		if err := parseZoneFileData(&record, tokens[1:], origin); err != nil {
+			return nil, fmt.Errorf("line %d: %s", entry.line, err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// parseZoneFileData fills the content, and priority, of the record
+func parseZoneFileData(record *egoscale.DNSRecord, data []string, origin string) error {
+	switch record.RecordType {
+	case "SOA":
+		record.Content = strings.Join(data, " ")
+	case "CNAME", "NS", "ALIAS", "POOL":
+		if len(data) != 1 {
+			return fmt.Errorf("%s requires a single target", record.RecordType)
+		}
+		record.Content = targetName(data[0], origin)
+	case "MX":
+		if len(data) != 2 {
+			return fmt.Errorf("MX requires a preference and a target")
+		}
+		prio, err := strconv.Atoi(data[0])
+		if err != nil {
+			return fmt.Errorf("invalid MX preference %q", data[0])
+		}
+		record.Prio = prio
+		record.Content = targetName(data[1], origin)
+	case "SRV":
+		if len(data) != 4 {
+			return fmt.Errorf("SRV requires a priority, a weight, a port and a target")
+		}
+		prio, err := strconv.Atoi(data[0])
+		if err != nil {
+			return fmt.Errorf("invalid SRV priority %q", data[0])
+		}
+		record.Prio = prio
+		record.Content = fmt.Sprintf("%s %s %s", data[1], data[2], targetName(data[3], origin))
+	case "TXT", "SPF":
+		var content bytes.Buffer
+		for _, value := range data {
+			content.WriteString(unquoteZoneFileString(value))
+		}
+		record.Content = content.String()
+	default:
+		supported := false
+		for _, recordType := range domainRecordTypes {
+			if recordType == record.RecordType {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("record type %q is not supported", record.RecordType)
+		}
+		record.Content = strings.Join(data, " ")
+	}
+
+	return nil
+}
+
+// renderZoneFile writes the records of the domain as an RFC 1035 master file
+func renderZoneFile(domain string, records []egoscale.DNSRecord) string {
+	sorted := make([]egoscale.DNSRecord, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.RecordType != b.RecordType {
+			// the SOA goes first, as usual
+			if a.RecordType == "SOA" || b.RecordType == "SOA" {
+				return a.RecordType == "SOA"
+			}
+			return a.RecordType < b.RecordType
+		}
+		if a.Prio != b.Prio {
+			return a.Prio < b.Prio
+		}
+		return a.Content < b.Content
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "$ORIGIN %s\n", absoluteName(domain, "."))
+	for _, record := range sorted {
+		name := record.Name
+		if name == "" {
+			name = "@"
+		}
+		fmt.Fprintf(&buf, "%s\t%d\tIN\t%s\t%s\n", name, record.TTL, record.RecordType, renderZoneFileData(record))
+	}
+
+	return buf.String()
+}
+
+// renderZoneFileData formats the content, and priority, of the record
+func renderZoneFileData(record egoscale.DNSRecord) string {
+	switch strings.ToUpper(record.RecordType) {
+	case "CNAME", "NS", "ALIAS", "POOL":
+		return absoluteName(record.Content, ".")
+	case "MX":
+		return fmt.Sprintf("%d %s", record.Prio, absoluteName(record.Content, "."))
+	case "SRV":
+		fields := strings.Fields(record.Content)
+		if len(fields) > 0 {
+			fields[len(fields)-1] = absoluteName(fields[len(fields)-1], ".")
+		}
+		return fmt.Sprintf("%d %s", record.Prio, strings.Join(fields, " "))
+	case "TXT", "SPF":
+		return quoteZoneFileString(record.Content)
+	}
+
+	return record.Content
+}
+
+// parseZoneFileTTL reads a TTL, either in seconds or using the BIND units (1h30m)
+func parseZoneFileTTL(value string) (int, error) {
+	if ttl, err := strconv.Atoi(value); err == nil && ttl >= 0 {
+		return ttl, nil
+	}
+
+	units := map[rune]int{
+		's': 1,
+		'm': 60,
+		'h': 60 * 60,
+		'd': 24 * 60 * 60,
+		'w': 7 * 24 * 60 * 60,
+	}
+
+	ttl := 0
+	number := -1
+	for _, c := range strings.ToLower(value) {
+		if c >= '0' && c <= '9' {
+			if number < 0 {
+				number = 0
+			}
+			number = number*10 + int(c-'0')
+			continue
+		}
+
+		unit, ok := units[c]
+		if !ok || number < 0 {
+			return 0, fmt.Errorf("invalid TTL %q", value)
+		}
+		ttl += number * unit
+		number = -1
+	}
+
+	if value == "" || number >= 0 {
+		return 0, fmt.Errorf("invalid TTL %q", value)
+	}
+
+	return ttl, nil
+}
+
+// absoluteName expands the name against the origin, @ being the origin itself
+func absoluteName(name, origin string) string {
+	if name == "@" {
+		return origin
+	}
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	if origin == "." {
+		return name + "."
+	}
+	return name + "." + origin
+}
+
+// relativeName returns the name within the zone, empty for the zone itself
+func relativeName(name, zone string) (string, error) {
+	if strings.EqualFold(name, zone) {
+		return "", nil
+	}
+
+	suffix := "." + zone
+	if len(name) <= len(suffix) || !strings.EqualFold(name[len(name)-len(suffix):], suffix) {
+		return "", fmt.Errorf("%q is outside of the zone %q", name, zone)
+	}
+
+	return name[:len(name)-len(suffix)], nil
+}
+
+// targetName expands the target against the origin, without the trailing dot
+func targetName(name, origin string) string {
+	return strings.TrimSuffix(absoluteName(name, origin), ".")
+}
+
+// unquoteZoneFileString removes the quotes and the escaping of a character string
+func unquoteZoneFileString(value string) string {
+	if len(value) < 2 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		return value
+	}
+
+	var buf bytes.Buffer
+	runes := []rune(value[1 : len(value)-1])
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\\' && i+1 < len(runes) {
+			i++
+		}
+		buf.WriteRune(runes[i])
+	}
+
+	return buf.String()
+}
+
+// quoteZoneFileString quotes the value, in chunks of 255 characters
+func quoteZoneFileString(value string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+	chunks := make([]string, 0, len(value)/255+1)
+	for len(value) > 255 {
+		chunks = append(chunks, `"`+escaper.Replace(value[:255])+`"`)
+		value = value[255:]
+	}
+	chunks = append(chunks, `"`+escaper.Replace(value)+`"`)
+
+	return strings.Join(chunks, " ")
+}
@@ -0,0 +1,128 @@
+package exoscale
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/exoscale/egoscale"
+)
+
+func TestParseZoneFile(t *testing.T) {
+	content := `
+$ORIGIN example.com.
+$TTL 1h
+@	IN	SOA	ns1.exoscale.ch. admin.example.com. (
+		2018010101 ; serial
+		86400 7200 604800 300 )
+	IN	NS	ns1.exoscale.ch.
+	IN	MX	10 mail
+	300	IN	MX	20 mx.example.net.
+www	A	1.2.3.4
+	A	1.2.3.5
+blog.example.com.	IN	CNAME	www
+@	TXT	"v=spf1 include:_spf.example.net -all" ; a comment
+_sip._tcp	SRV	10 60 5060 sip
+$ORIGIN sub.example.com.
+api	30m	IN	AAAA	2001:db8::1
+`
+
+	records, err := parseZoneFile("example.com", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []egoscale.DNSRecord{
+		{Name: "", RecordType: "SOA", TTL: 3600, Content: "ns1.exoscale.ch. admin.example.com. 2018010101 86400 7200 604800 300"},
+		{Name: "", RecordType: "NS", TTL: 3600, Content: "ns1.exoscale.ch"},
+		{Name: "", RecordType: "MX", TTL: 3600, Content: "mail.example.com", Prio: 10},
+		{Name: "", RecordType: "MX", TTL: 300, Content: "mx.example.net", Prio: 20},
+		{Name: "www", RecordType: "A", TTL: 3600, Content: "1.2.3.4"},
+		{Name: "www", RecordType: "A", TTL: 3600, Content: "1.2.3.5"},
+		{Name: "blog", RecordType: "CNAME", TTL: 3600, Content: "www.example.com"},
+		{Name: "", RecordType: "TXT", TTL: 3600, Content: "v=spf1 include:_spf.example.net -all"},
+		{Name: "_sip._tcp", RecordType: "SRV", TTL: 3600, Content: "60 5060 sip.example.com", Prio: 10},
+		{Name: "api.sub", RecordType: "AAAA", TTL: 1800, Content: "2001:db8::1"},
+	}
+
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("bad records, got %#v", records)
+	}
+}
+
+func TestParseZoneFileFailure(t *testing.T) {
+	contents := map[string]string{
+		"outside of the zone": "www.example.net. A 1.2.3.4",
+		"unsupported type":    "www PTR example.com.",
+		"missing data":        "www A",
+		"no owner":            "  A 1.2.3.4",
+		"unbalanced":          "@ SOA ns1 admin ( 1 2 3 4 5",
+		"unterminated quote":  "@ TXT \"hello\nworld\"",
+		"include":             "$INCLUDE other.zone",
+		"bad MX":              "@ MX ten mail",
+	}
+
+	for name, content := range contents {
+		if _, err := parseZoneFile("example.com", content); err == nil {
+			t.Errorf("%s: an error was expected", name)
+		}
+	}
+}
+
+func TestRenderZoneFile(t *testing.T) {
+	records := []egoscale.DNSRecord{
+		{Name: "www", RecordType: "A", TTL: 300, Content: "1.2.3.4"},
+		{Name: "", RecordType: "MX", TTL: 3600, Content: "mail.example.com", Prio: 10},
+		{Name: "", RecordType: "TXT", TTL: 3600, Content: `say "hello"`},
+		{Name: "", RecordType: "SOA", TTL: 3600, Content: "ns1.exoscale.ch admin.dnsimple.com 1 86400 7200 604800 300"},
+		{Name: "_sip._tcp", RecordType: "SRV", TTL: 3600, Content: "60 5060 sip.example.com", Prio: 10},
+	}
+
+	expected := `$ORIGIN example.com.
+@	3600	IN	SOA	ns1.exoscale.ch admin.dnsimple.com 1 86400 7200 604800 300
+@	3600	IN	MX	10 mail.example.com.
+@	3600	IN	TXT	"say \"hello\""
+_sip._tcp	3600	IN	SRV	10 60 5060 sip.example.com.
+www	300	IN	A	1.2.3.4
+`
+
+	content := renderZoneFile("example.com", records)
+	if content != expected {
+		t.Errorf("bad zone file, got:\n%s", content)
+	}
+
+	parsed, err := parseZoneFile("example.com", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sameZoneFileRecords(records, parsed) {
+		t.Errorf("the zone file doesn't round trip, got %#v", parsed)
+	}
+}
+
+func TestParseZoneFileTTL(t *testing.T) {
+	values := map[string]int{
+		"300":   300,
+		"1h":    3600,
+		"1h30m": 5400,
+		"1W":    604800,
+		"2d12h": 216000,
+	}
+
+	for value, expected := range values {
+		ttl, err := parseZoneFileTTL(value)
+		if err != nil {
+			t.Errorf("%s: %s", value, err)
+			continue
+		}
+		if ttl != expected {
+			t.Errorf("%s: expected %d, got %d", value, expected, ttl)
+		}
+	}
+
+	for _, value := range []string{"", "A", "MX", "h", "10x", "1h30"} {
+		if _, err := parseZoneFileTTL(value); err == nil {
+			t.Errorf("%q: an error was expected", value)
+		}
+	}
+}